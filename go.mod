@@ -3,7 +3,9 @@ module github.com/Baumanar/log-monitor
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/hpcloud/tail v1.0.0
+	github.com/klauspost/compress v1.11.13
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/mum4k/termdash v0.11.0
@@ -11,4 +13,5 @@ require (
 	golang.org/x/sys v0.0.0-20200602225109-6fdc65e7d980 // indirect
 	gopkg.in/fsnotify.v1 v1.4.7 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -2,14 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/api"
+	"github.com/Baumanar/log-monitor/pkg/config"
 	"github.com/Baumanar/log-monitor/pkg/display"
 	"github.com/Baumanar/log-monitor/pkg/generator"
+	"github.com/Baumanar/log-monitor/pkg/metrics"
 	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/notify"
+	"github.com/Baumanar/log-monitor/pkg/sink"
+	"github.com/Baumanar/log-monitor/pkg/store"
+	"github.com/Baumanar/log-monitor/pkg/syslog"
+	"github.com/Baumanar/log-monitor/pkg/web"
 	"log"
 	"math/rand"
+	"net"
+	"net/smtp"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -19,17 +33,39 @@ func main() {
 	// Create a global context used by the monitor and the display for cancellation signals
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Flags of the app
-	isDemo := flag.Bool("demo", false, "demo or not, if demo the log file will be concurrently written with fake logs")
-	logFile := flag.String("logfile", "/tmp/access.log", "logfile path")
-	timeWindow := flag.Int("timewindow", 120, "time window for alerting in seconds")
-	threshold := flag.Int("threshold", 10, "threshold for alerting in requests per second")
-	updateInterval := flag.Int("updateInterval", 10, "number of seconds between each statistic update")
-	flag.Parse()
+	// Settings of the app, from the config file, the environment and the flags
+	conf, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop gracefully on SIGINT and SIGTERM, a second signal exits immediately
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
+	shutdownDeadline := time.Duration(conf.ShutdownTimeout) * time.Second
+
+	// Get the log files and verify that they exist
+	// With a syslog listener, the default log file is not read
+	var logFiles []string
+	if conf.Listen == "" || conf.IsSet("logfile") {
+		if logFiles, err = monitoring.ExpandFiles(strings.Split(conf.LogFile, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	// Verify that the log file exists
-	if _, err := os.Stat(*logFile); os.IsNotExist(err) {
-		log.Fatal(fmt.Sprintf("file %s does not exist.", *logFile))
+	// Get the parser of the log format
+	parser, err := monitoring.NewParser(conf.Format, conf.LogFormat)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Channel to display statistics
@@ -37,22 +73,240 @@ func main() {
 	// Channel to alert
 	alertChan := make(chan monitoring.AlertRecord)
 
-	// Create a new monitor and a new display with the given parameters
-	monitor := monitoring.New(ctx, cancel, *logFile, statChan, alertChan, *timeWindow, *updateInterval, *threshold, true)
-	display := display.New(ctx, cancel, statChan, alertChan)
+	// Create a new monitor with the given parameters
+	monitorConfig := conf.Monitor()
+	monitorConfig.LogFiles = logFiles
+	monitorConfig.Parser = parser
+	monitor, err := monitoring.New(ctx, cancel, monitorConfig, statChan, alertChan)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if conf.Listen != "" {
+		server, err := syslog.Listen(conf.Listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		monitor.Sources = append(monitor.Sources, server)
+	}
+	if conf.Rules != "" {
+		rules, err := monitoring.LoadRules(conf.Rules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := monitor.SetRules(rules); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Create the sinks receiving the statistics and alerts of the monitor
+	var sinks []sink.Sink
+	var dashboard *display.Display
+	switch conf.Output {
+	case config.OutputTUI:
+		// The display reads its own channels, fed by a channel sink
+		displayStatChan := make(chan monitoring.StatRecord)
+		displayAlertChan := make(chan monitoring.AlertRecord)
+		dashboard = display.New(ctx, cancel, displayStatChan, displayAlertChan)
+		sinks = append(sinks, sink.NewChannel(ctx, displayStatChan, displayAlertChan))
+	case config.OutputJSON:
+		writer := os.Stdout
+		if conf.OutFile != "-" {
+			writer, err = os.OpenFile(conf.OutFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		sinks = append(sinks, sink.NewJSON(writer))
+	case config.OutputNone:
+		// Only the web dashboard, the metrics and the notifications receive the records
+	default:
+		log.Fatal(fmt.Sprintf("unknown output %s, expected tui, json or none", conf.Output))
+	}
+
+	// Keep the statistics of every interval on disk, the terminal dashboard starts with the last hour stored
+	var trends *store.Store
+	if conf.Store != "" {
+		retention, err := store.ParseRetention(conf.Retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trends, err = store.Open(conf.Store, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, trends)
+		if dashboard != nil {
+			points, err := trends.Query(store.Raw, trends.Latest().Add(-time.Hour), time.Time{})
+			if err != nil {
+				log.Fatal(err)
+			}
+			requests := make([]int, len(points))
+			for i, point := range points {
+				requests[i] = point.NumRequests
+			}
+			dashboard.Preload(requests)
+		}
+	}
+
+	// A server that stops by itself stops the app, its error is reported once the display is closed
+	serveErr := make(chan error, 3)
+	serve := func(name string, run func() error) {
+		if err := run(); err != nil {
+			serveErr <- fmt.Errorf("the %s server stopped: %v", name, err)
+			cancel()
+		}
+	}
+
+	// Expose the Prometheus metrics
+	if conf.Metrics != "" {
+		listener, err := net.Listen("tcp", conf.Metrics)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exporter := metrics.New()
+		sinks = append(sinks, exporter)
+		go serve("metrics", func() error { return metrics.Serve(ctx, listener, exporter) })
+	}
+
+	// Serve the web dashboard
+	if conf.Web != "" {
+		listener, err := net.Listen("tcp", conf.Web)
+		if err != nil {
+			log.Fatal(err)
+		}
+		page := web.New()
+		sinks = append(sinks, page)
+		go serve("dashboard", func() error { return web.Serve(ctx, listener, page) })
+	}
+
+	// Serve the recent statistics and alerts with the JSON API
+	if conf.API != "" {
+		listener, err := net.Listen("tcp", conf.API)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history := api.NewHistory(conf.History, trends)
+		sinks = append(sinks, history)
+		go serve("API", func() error { return api.Serve(ctx, listener, history) })
+	}
+
+	// Send the alerts to the notification services
+	var notifiers []notify.Notifier
+	if conf.Webhook != "" {
+		notifiers = append(notifiers, notify.NewWebhook(conf.Webhook))
+	}
+	if conf.Slack != "" {
+		notifiers = append(notifiers, notify.NewSlack(conf.Slack))
+	}
+	if conf.SMTP != "" {
+		email := &notify.Email{Addr: conf.SMTP, From: conf.MailFrom, To: conf.Recipients()}
+		if conf.SMTPUser != "" {
+			host, _, err := net.SplitHostPort(conf.SMTP)
+			if err != nil {
+				log.Fatal(err)
+			}
+			email.Auth = smtp.PlainAuth("", conf.SMTPUser, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		notifiers = append(notifiers, email)
+	}
+	if len(notifiers) > 0 {
+		dispatcher := notify.NewDispatcher(notifiers...)
+		// The notifications in flight are waited for when stopping, each attempt keeps its own timeout
+		dispatcher.CloseTimeout = shutdownDeadline
+		// Failures would be drawn over the dashboard, only log them without it
+		if conf.Output != config.OutputTUI {
+			dispatcher.Logger = log.New(os.Stderr, "", log.LstdFlags)
+		}
+		sinks = append(sinks, dispatcher)
+	}
 
 	// If the app is running in demo mode, write concurrently logs to the log file
-	if *isDemo {
+	// There is nothing to write when the log file is replayed
+	if conf.Demo && !conf.Replay {
+		if logFiles[0] == monitoring.StdinName {
+			log.Fatal("the demo writes a log file, it cannot use the standard input")
+		}
 		// Get a random seed
 		rand.Seed(time.Now().UnixNano())
 		// Write logs in a goroutine
-		go generator.LogGenerator(ctx, *logFile, startInterval)
+		go generator.LogGenerator(ctx, logFiles[0], startInterval)
 	}
 
+	// Apply the new settings on SIGHUP, the failures would be drawn over the dashboard so they are only logged without it
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := reload(monitor); err != nil && conf.Output != config.OutputTUI {
+				log.Printf("the settings were not reloaded: %v", err)
+			}
+		}
+	}()
+
 	// Run the monitor in a goroutine
-	go monitor.Run()
+	if conf.Replay {
+		go monitor.Replay(conf.Speed)
+	} else {
+		go monitor.Run()
+	}
 
-	// Do the displaying
-	display.Run()
+	// Forward the records to the sinks until the monitor stops
+	dispatchErr := make(chan error, 1)
+	go func() {
+		err := sink.Dispatch(statChan, alertChan, sinks...)
+		if err != nil {
+			cancel()
+		}
+		dispatchErr <- err
+	}()
+	// Without display, wait for the monitor to stop
+	if dashboard != nil {
+		dashboard.Run()
+	}
 
+	// The display has released the terminal, report why the monitor stopped if it failed
+	err = waitDispatch(ctx, dispatchErr, 2*shutdownDeadline)
+	if monitorErr := monitor.Err(); monitorErr != nil {
+		log.Fatal(monitorErr)
+	}
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	default:
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reload reads the settings again and applies the alerting ones to the monitor
+// The alert rules are read again from their file
+func reload(monitor *monitoring.LogMonitor) error {
+	conf, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err != nil {
+		return err
+	}
+	var rules []monitoring.Rule
+	if conf.Rules != "" {
+		if rules, err = monitoring.LoadRules(conf.Rules); err != nil {
+			return err
+		}
+	}
+	return monitor.Reload(conf.Monitor(), rules)
+}
+
+// waitDispatch waits for the sinks to receive the last records
+// Once ctx is cancelled, it gives up after timeout
+func waitDispatch(ctx context.Context, dispatchErr <-chan error, timeout time.Duration) error {
+	select {
+	case err := <-dispatchErr:
+		return err
+	case <-ctx.Done():
+	}
+	select {
+	case err := <-dispatchErr:
+		return err
+	case <-time.After(timeout):
+		return errors.New("the last statistics could not be sent before the shutdown timeout")
+	}
 }
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/httpserver"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/store"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Dimensions of the /api/top endpoint
+const (
+	DimSection = "section"
+	DimMethod  = "method"
+	DimStatus  = "status"
+	DimHost    = "host"
+	DimUser    = "user"
+)
+
+// DefaultLimit is the number of entries returned by /api/top without limit
+const DefaultLimit = 10
+
+// Top is the response of /api/top
+type Top struct {
+	Dim string `json:"dim"`
+	// Start of the oldest and of the latest interval counted
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Number of intervals counted
+	Intervals int `json:"intervals"`
+	// The hosts and users are summed from the top lists of each interval, the ones that were never at the top are missing
+	Approximate bool              `json:"approximate,omitempty"`
+	Top         []monitoring.Pair `json:"top"`
+}
+
+// ServeHTTP serves the JSON API
+//
+//	GET /api/stats?since=15m            statistics of the intervals since a date or a duration before the latest interval
+//	GET /api/alerts?since=2020-03-27T12:00:00Z
+//	GET /api/top?dim=section&window=15m&limit=10&source=access.log
+//	GET /api/trends?resolution=1h&since=168h  points of the store, since a duration before its latest interval
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	query := r.URL.Query()
+	stats := h.Stats()
+	var latest time.Time
+	if len(stats) > 0 {
+		latest = stats[len(stats)-1].Time
+	}
+	switch r.URL.Path {
+	case "/api/stats":
+		since, err := parseSince(query.Get("since"), latest)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		result := []monitoring.StatRecord{}
+		for _, stat := range stats {
+			if !stat.Time.Before(since) {
+				result = append(result, stat)
+			}
+		}
+		writeJSON(w, result)
+	case "/api/alerts":
+		since, err := parseSince(query.Get("since"), latest)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		result := []monitoring.AlertRecord{}
+		for _, alert := range h.Alerts() {
+			if !alert.Time.Before(since) {
+				result = append(result, alert)
+			}
+		}
+		writeJSON(w, result)
+	case "/api/top":
+		top, err := topOf(stats, query.Get("dim"), query.Get("window"), query.Get("limit"), query.Get("source"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, top)
+	case "/api/trends":
+		if h.trends == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("the statistics are not stored, see the store setting"))
+			return
+		}
+		since, err := parseSince(query.Get("since"), h.trends.Latest())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resolution := query.Get("resolution")
+		if resolution == "" {
+			resolution = store.Hour
+		}
+		points, err := h.trends.Query(resolution, since, time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, points)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s, expected /api/stats, /api/alerts, /api/top or /api/trends", r.URL.Path))
+	}
+}
+
+// parseSince returns the date given by since: a RFC 3339 date, or a duration before latest
+// An empty since gives the zero time, before every record
+func parseSince(since string, latest time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse(time.RFC3339, since); err == nil {
+		return date, nil
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q, expected a RFC 3339 date or a positive duration", since)
+	}
+	return latest.Add(-d), nil
+}
+
+// topOf sums the counts of the dimension dim over the intervals of the window ending with the latest interval
+// An empty window sums every interval kept, a source restricts the counts to one log file
+func topOf(stats []monitoring.StatRecord, dim string, window string, limit string, source string) (Top, error) {
+	top := Top{Dim: dim, Approximate: dim == DimHost || dim == DimUser, Top: []monitoring.Pair{}}
+	switch dim {
+	case DimSection, DimMethod, DimStatus, DimHost, DimUser:
+	default:
+		return top, fmt.Errorf("invalid dim %q, expected section, method, status, host or user", dim)
+	}
+	n := DefaultLimit
+	if limit != "" {
+		var err error
+		if n, err = strconv.Atoi(limit); err != nil || n <= 0 {
+			return top, fmt.Errorf("invalid limit %q, expected a positive number", limit)
+		}
+	}
+	var from time.Time
+	if window != "" && len(stats) > 0 {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return top, fmt.Errorf("invalid window %q, expected a positive duration such as 15m", window)
+		}
+		from = stats[len(stats)-1].Time.Add(-d)
+	}
+
+	counts := make(map[string]int)
+	for _, stat := range stats {
+		// The window ends with the latest interval
+		if !stat.Time.After(from) {
+			continue
+		}
+		if source != "" {
+			var ok bool
+			if stat, ok = stat.Sources[source]; !ok {
+				continue
+			}
+		}
+		if top.Intervals == 0 {
+			top.From = stat.Time
+		}
+		top.To = stat.Time
+		top.Intervals++
+		switch dim {
+		case DimSection:
+			addCounts(counts, stat.Sections)
+		case DimMethod:
+			addCounts(counts, stat.Methods)
+		case DimStatus:
+			addCounts(counts, stat.Status)
+		case DimHost:
+			addPairs(counts, stat.TopHosts)
+		case DimUser:
+			addPairs(counts, stat.TopUsers)
+		}
+	}
+	for key, value := range counts {
+		top.Top = append(top.Top, monitoring.Pair{Key: key, Value: value})
+	}
+	// The ties are sorted by key so that the result is stable
+	sort.Slice(top.Top, func(i, j int) bool {
+		if top.Top[i].Value != top.Top[j].Value {
+			return top.Top[i].Value > top.Top[j].Value
+		}
+		return top.Top[i].Key < top.Top[j].Key
+	})
+	if len(top.Top) > n {
+		top.Top = top.Top[:n]
+	}
+	return top, nil
+}
+
+// addCounts adds the counts of an interval to the totals
+func addCounts(totals map[string]int, counts map[string]int) {
+	for key, value := range counts {
+		totals[key] += value
+	}
+}
+
+// addPairs adds the top list of an interval to the totals
+func addPairs(totals map[string]int, pairs []monitoring.Pair) {
+	for _, pair := range pairs {
+		totals[pair.Key] += pair.Value
+	}
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error as a JSON object with an error key
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// Serve serves the API of h on listener until ctx is cancelled
+func Serve(ctx context.Context, listener net.Listener, h *History) error {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", h)
+	return httpserver.Serve(ctx, listener, mux)
+}
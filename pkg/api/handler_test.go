@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/store"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// start is the time of the first interval of the tests
+var start = time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+
+// newTestHistory returns a History of 4 intervals of 5 minutes starting at 12:00 and of 2 alerts
+func newTestHistory() *History {
+	history := NewHistory(DefaultSize, nil)
+	for i := 0; i < 4; i++ {
+		history.WriteStat(monitoring.StatRecord{
+			Time:        start.Add(time.Duration(i) * 5 * time.Minute),
+			NumRequests: 10 * i,
+			Sections:    map[string]int{"/api": i, "/home": 2, "/report": 3 - i},
+			Methods:     map[string]int{"GET": 10 * i},
+			Status:      map[string]int{"2xx": i},
+			TopHosts:    []monitoring.Pair{{Key: "10.0.0.1", Value: i}},
+			Sources:     map[string]monitoring.StatRecord{"a.log": {Time: start.Add(time.Duration(i) * 5 * time.Minute), Sections: map[string]int{"/a": 1}}},
+		})
+	}
+	history.WriteAlert(monitoring.AlertRecord{Alert: true, NumTraffic: 1300, Time: start.Add(5 * time.Minute)})
+	history.WriteAlert(monitoring.AlertRecord{Alert: false, NumTraffic: 100, Time: start.Add(15 * time.Minute)})
+	return history
+}
+
+// Checks the responses of every endpoint
+func TestHistory_ServeHTTP(t *testing.T) {
+	server := httptest.NewServer(newTestHistory())
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"test0", "/api/stats", http.StatusOK, `"requests":0`},
+		{"test1", "/api/stats?since=10m", http.StatusOK, `"time":"2020-03-27T12:05:00Z"`},
+		{"test2", "/api/stats?since=2020-03-27T12:15:00Z", http.StatusOK, `"time":"2020-03-27T12:15:00Z"`},
+		{"test3", "/api/stats?since=yesterday", http.StatusBadRequest, `invalid since`},
+		{"test4", "/api/alerts", http.StatusOK, `"traffic":1300`},
+		{"test5", "/api/alerts?since=5m", http.StatusOK, `"traffic":100`},
+		{"test6", "/api/top?dim=section", http.StatusOK, `"top":[{"key":"/home","value":8},{"key":"/api","value":6},{"key":"/report","value":6}]`},
+		{"test7", "/api/top?dim=section&window=10m", http.StatusOK, `"intervals":2,"top":[{"key":"/api","value":5},{"key":"/home","value":4},{"key":"/report","value":1}]`},
+		{"test8", "/api/top?dim=section&window=10m&limit=1", http.StatusOK, `"top":[{"key":"/api","value":5}]`},
+		{"test9", "/api/top?dim=host", http.StatusOK, `"approximate":true,"top":[{"key":"10.0.0.1","value":6}]`},
+		{"test10", "/api/top?dim=section&source=a.log", http.StatusOK, `"top":[{"key":"/a","value":4}]`},
+		{"test11", "/api/top?dim=country", http.StatusBadRequest, `invalid dim`},
+		{"test12", "/api/top?dim=method&window=-5m", http.StatusBadRequest, `invalid window`},
+		{"test13", "/api/top?dim=status&limit=0", http.StatusBadRequest, `invalid limit`},
+		{"test14", "/api/unknown", http.StatusNotFound, `unknown endpoint`},
+		{"test15", "/api/trends", http.StatusNotFound, `not stored`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.want) {
+				t.Errorf("GET %s = %d %s, want %d with %s", tt.path, resp.StatusCode, body, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that since filters the statistics from the given interval
+func TestHistory_statsSince(t *testing.T) {
+	server := httptest.NewServer(newTestHistory())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/api/stats?since=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var stats []monitoring.StatRecord
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 || stats[0].NumRequests != 10 {
+		t.Errorf("GET /api/stats?since=10m returned %d intervals", len(stats))
+	}
+}
+
+// Checks that the trends are read from the store
+func TestHistory_trends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trends, err := store.Open(dir, store.DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trends.Close()
+	// One request every 10 seconds from 12:00 to 14:30
+	for d := time.Duration(0); d < 150*time.Minute; d += 10 * time.Second {
+		trends.WriteStat(monitoring.StatRecord{Time: start.Add(d), NumRequests: 1})
+	}
+	server := httptest.NewServer(NewHistory(DefaultSize, trends))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   []int
+	}{
+		{"test0", "/api/trends", http.StatusOK, []int{360, 360, 180}},
+		{"test1", "/api/trends?resolution=1h&since=1h", http.StatusOK, []int{360, 180}},
+		{"test2", "/api/trends?resolution=1m&since=2m", http.StatusOK, []int{6, 6, 6}},
+		{"test3", "/api/trends?resolution=raw&since=20s", http.StatusOK, []int{1, 1, 1}},
+		{"test4", "/api/trends?resolution=1d", http.StatusBadRequest, nil},
+		{"test5", "/api/trends?since=week", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s = %d", tt.path, resp.StatusCode)
+			}
+			if tt.want == nil {
+				return
+			}
+			var points []store.Point
+			if err := json.NewDecoder(resp.Body).Decode(&points); err != nil {
+				t.Fatal(err)
+			}
+			got := []int{}
+			for _, point := range points {
+				got = append(got, point.NumRequests)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GET %s = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/store"
+	"sync"
+)
+
+// DefaultSize is the default number of intervals kept by a History, one hour with the default update interval
+const DefaultSize = 360
+
+// History is a Sink keeping the last statistics and alerts of the monitor in ring buffers
+// It serves them with a JSON API, see ServeHTTP
+type History struct {
+	// mutex for thread safety, the sink and the HTTP server run in different goroutines
+	mutex  sync.Mutex
+	stats  ring
+	alerts ring
+	// store of the older statistics served by /api/trends, nil if they are not stored
+	trends *store.Store
+}
+
+// ring is a ring buffer of the last records
+type ring struct {
+	records []interface{}
+	// index of the next record to write, the oldest one once the buffer is full
+	next  int
+	count int
+}
+
+// NewHistory returns a History keeping the last size intervals and the last size alerts
+// trends is the store read by /api/trends, it may be nil
+func NewHistory(size int, trends *store.Store) *History {
+	return &History{
+		stats:  ring{records: make([]interface{}, size)},
+		alerts: ring{records: make([]interface{}, size)},
+		trends: trends,
+	}
+}
+
+// add writes a record in place of the oldest one
+func (r *ring) add(record interface{}) {
+	r.records[r.next] = record
+	r.next = (r.next + 1) % len(r.records)
+	if r.count < len(r.records) {
+		r.count++
+	}
+}
+
+// each calls f with the records from the oldest one
+func (r *ring) each(f func(record interface{})) {
+	first := (r.next - r.count + len(r.records)) % len(r.records)
+	for i := 0; i < r.count; i++ {
+		f(r.records[(first+i)%len(r.records)])
+	}
+}
+
+// WriteStat keeps the statistics of an interval
+func (h *History) WriteStat(stat monitoring.StatRecord) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.stats.add(stat)
+	return nil
+}
+
+// WriteAlert keeps an alert, or a reload of the settings
+func (h *History) WriteAlert(alert monitoring.AlertRecord) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.alerts.add(alert)
+	return nil
+}
+
+// Close does nothing, the history stays available until the server stops
+func (h *History) Close() error {
+	return nil
+}
+
+// Stats returns the statistics kept, from the oldest interval
+func (h *History) Stats() []monitoring.StatRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := make([]monitoring.StatRecord, 0, h.stats.count)
+	h.stats.each(func(record interface{}) {
+		stats = append(stats, record.(monitoring.StatRecord))
+	})
+	return stats
+}
+
+// Alerts returns the alerts kept, from the oldest one
+func (h *History) Alerts() []monitoring.AlertRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	alerts := make([]monitoring.AlertRecord, 0, h.alerts.count)
+	h.alerts.each(func(record interface{}) {
+		alerts = append(alerts, record.(monitoring.AlertRecord))
+	})
+	return alerts
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"reflect"
+	"testing"
+)
+
+// Checks that the ring buffers keep the last records in order
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []int
+	}{
+		{"test0", 3, 0, []int{}},
+		{"test1", 3, 2, []int{0, 1}},
+		{"test2", 3, 3, []int{0, 1, 2}},
+		{"test3", 3, 7, []int{4, 5, 6}},
+		{"test4", 1, 2, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewHistory(tt.size, nil)
+			for i := 0; i < tt.added; i++ {
+				history.WriteStat(monitoring.StatRecord{NumRequests: i})
+				history.WriteAlert(monitoring.AlertRecord{NumTraffic: i})
+			}
+			stats, alerts := []int{}, []int{}
+			for _, stat := range history.Stats() {
+				stats = append(stats, stat.NumRequests)
+			}
+			for _, alert := range history.Alerts() {
+				alerts = append(alerts, alert.NumTraffic)
+			}
+			if !reflect.DeepEqual(stats, tt.want) || !reflect.DeepEqual(alerts, tt.want) {
+				t.Errorf("Stats() = %v, Alerts() = %v, want %v", stats, alerts, tt.want)
+			}
+		})
+	}
+}
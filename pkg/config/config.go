@@ -0,0 +1,321 @@
+// Package config gathers the settings of the log monitor
+// They are read from a YAML or TOML file, then from the LOGMONITOR_* environment variables
+// and last from the command line flags, each source overriding the previous ones
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/api"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/store"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the settings,
+// the variable of a setting is the prefix followed by its name in upper case, for instance LOGMONITOR_TIMEWINDOW
+const EnvPrefix = "LOGMONITOR_"
+
+// Values of the output setting
+const (
+	OutputTUI  = "tui"
+	OutputJSON = "json"
+	OutputNone = "none"
+)
+
+// Config holds the settings of the log monitor
+// The keys of the file, the flags and the environment variables have the same names
+type Config struct {
+	// File the settings were read from, set with the config flag or the LOGMONITOR_CONFIG variable
+	File string `yaml:"-" toml:"-"`
+
+	Demo            bool    `yaml:"demo" toml:"demo"`
+	LogFile         string  `yaml:"logfile" toml:"logfile"`
+	TimeWindow      int     `yaml:"timewindow" toml:"timewindow"`
+	Threshold       int     `yaml:"threshold" toml:"threshold"`
+	Recover         int     `yaml:"recover" toml:"recover"`
+	For             int     `yaml:"for" toml:"for"`
+	UpdateInterval  int     `yaml:"updateInterval" toml:"updateInterval"`
+	Lateness        int     `yaml:"lateness" toml:"lateness"`
+	Replay          bool    `yaml:"replay" toml:"replay"`
+	Rotated         bool    `yaml:"rotated" toml:"rotated"`
+	Speed           float64 `yaml:"speed" toml:"speed"`
+	Output          string  `yaml:"output" toml:"output"`
+	OutFile         string  `yaml:"outfile" toml:"outfile"`
+	Metrics         string  `yaml:"metrics" toml:"metrics"`
+	Web             string  `yaml:"web" toml:"web"`
+	API             string  `yaml:"api" toml:"api"`
+	History         int     `yaml:"history" toml:"history"`
+	Store           string  `yaml:"store" toml:"store"`
+	Retention       string  `yaml:"retention" toml:"retention"`
+	Rules           string  `yaml:"rules" toml:"rules"`
+	Format          string  `yaml:"format" toml:"format"`
+	LogFormat       string  `yaml:"logformat" toml:"logformat"`
+	OnError         string  `yaml:"onerror" toml:"onerror"`
+	Quarantine      string  `yaml:"quarantine" toml:"quarantine"`
+	Anonymize       string  `yaml:"anonymize" toml:"anonymize"`
+	HashKey         string  `yaml:"hashkey" toml:"hashkey"`
+	Webhook         string  `yaml:"webhook" toml:"webhook"`
+	Slack           string  `yaml:"slack" toml:"slack"`
+	SMTP            string  `yaml:"smtp" toml:"smtp"`
+	SMTPUser        string  `yaml:"smtpuser" toml:"smtpuser"`
+	MailFrom        string  `yaml:"mailfrom" toml:"mailfrom"`
+	MailTo          string  `yaml:"mailto" toml:"mailto"`
+	ShutdownTimeout int     `yaml:"shutdowntimeout" toml:"shutdowntimeout"`
+	Listen          string  `yaml:"listen" toml:"listen"`
+	StateFile       string  `yaml:"statefile" toml:"statefile"`
+
+	// names of the settings given by the file, the environment or the flags
+	set map[string]bool
+}
+
+// Default returns the default settings
+func Default() *Config {
+	return &Config{
+		LogFile:         "/tmp/access.log",
+		TimeWindow:      120,
+		Threshold:       10,
+		Recover:         -1,
+		For:             1,
+		UpdateInterval:  10,
+		Output:          OutputTUI,
+		OutFile:         "-",
+		Format:          monitoring.FormatCommon,
+		LogFormat:       monitoring.NginxCombinedFormat,
+		OnError:         string(monitoring.PolicyCount),
+		Quarantine:      "/tmp/access.quarantine.log",
+		Anonymize:       string(monitoring.AnonymizeNone),
+		MailFrom:        "log-monitor@localhost",
+		ShutdownTimeout: 5,
+		History:         api.DefaultSize,
+		Retention:       store.DefaultRetention.String(),
+		set:             make(map[string]bool),
+	}
+}
+
+// Load returns the settings given by the config file, the environment and the command line arguments
+// getenv reads the environment variables, usually os.Getenv
+// The settings are validated, flag.ErrHelp is returned if the help was asked
+func Load(name string, args []string, getenv func(string) string) (*Config, error) {
+	// A first parsing of the arguments finds the config file, it reports the flag errors and prints the help
+	first := Default()
+	first.File = getenv(EnvPrefix + "CONFIG")
+	if err := first.FlagSet(name, flag.ContinueOnError).Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	if first.File != "" {
+		if err := c.LoadFile(first.File); err != nil {
+			return nil, err
+		}
+	}
+	flags := c.FlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if err := c.loadEnv(flags, getenv); err != nil {
+		return nil, err
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		c.set[f.Name] = true
+	})
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FlagSet returns the flags of the settings, they write to the fields of c and default to their current values
+func (c *Config) FlagSet(name string, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, errorHandling)
+	fs.StringVar(&c.File, "config", c.File, "YAML (.yml, .yaml) or TOML (.toml) file of settings, overridden by the LOGMONITOR_* environment variables and by the flags")
+	fs.BoolVar(&c.Demo, "demo", c.Demo, "demo or not, if demo the log file will be concurrently written with fake logs")
+	fs.StringVar(&c.LogFile, "logfile", c.LogFile, "logfile path, several files can be given separated by commas or with a glob pattern, - reads the standard input")
+	fs.IntVar(&c.TimeWindow, "timewindow", c.TimeWindow, "time window for alerting in seconds, a multiple of updateInterval")
+	fs.IntVar(&c.Threshold, "threshold", c.Threshold, "threshold for alerting in requests per second")
+	fs.IntVar(&c.Recover, "recover", c.Recover, "threshold under which the alert recovers in requests per second, at least 1, the alerting threshold if negative")
+	fs.IntVar(&c.For, "for", c.For, "number of consecutive updates the threshold must be crossed before alerting or recovering")
+	fs.IntVar(&c.UpdateInterval, "updateInterval", c.UpdateInterval, "number of seconds between each statistic update")
+	fs.IntVar(&c.Lateness, "lateness", c.Lateness, "number of seconds to wait for delayed lines before reporting an interval")
+	fs.BoolVar(&c.Replay, "replay", c.Replay, "read the log file from its beginning with a time simulated from the log dates, then exit")
+	fs.BoolVar(&c.Rotated, "rotated", c.Rotated, "with -replay, also read the rotated archives of the log files (.1, .2.gz, .3.zst...) from the oldest")
+	fs.Float64Var(&c.Speed, "speed", c.Speed, "speed multiplier of the replay, 0 replays as fast as possible")
+	fs.StringVar(&c.Output, "output", c.Output, "where statistics and alerts are written: tui for the terminal dashboard, json for JSON lines, none with only -web, -api, -metrics or the notifications")
+	fs.StringVar(&c.OutFile, "outfile", c.OutFile, "file where the JSON lines are appended, - for the standard output")
+	fs.StringVar(&c.Metrics, "metrics", c.Metrics, "address of the Prometheus /metrics endpoint, for instance :9100, disabled if empty")
+	fs.StringVar(&c.Web, "web", c.Web, "address of the web dashboard, for instance :8080, disabled if empty")
+	fs.StringVar(&c.API, "api", c.API, "address of the JSON API serving the recent statistics and alerts, for instance :8081, disabled if empty")
+	fs.IntVar(&c.History, "history", c.History, "number of intervals and alerts kept by the JSON API")
+	fs.StringVar(&c.Store, "store", c.Store, "directory where the statistics of every interval are kept with their 1m and 1h rollups, disabled if empty")
+	fs.StringVar(&c.Retention, "retention", c.Retention, "how long each resolution of the store is kept")
+	fs.StringVar(&c.Rules, "rules", c.Rules, "YAML or TOML file of additional alert rules")
+	fs.StringVar(&c.Format, "format", c.Format, "format of the log file: common, combined, nginx, json or caddy")
+	fs.StringVar(&c.LogFormat, "logformat", c.LogFormat, "nginx log_format string, used with -format nginx")
+	fs.StringVar(&c.OnError, "onerror", c.OnError, "what to do with malformed lines: skip, count, quarantine or abort")
+	fs.StringVar(&c.Quarantine, "quarantine", c.Quarantine, "file where malformed lines are written, used with -onerror quarantine")
+	fs.StringVar(&c.Anonymize, "anonymize", c.Anonymize, "how remote hosts are anonymised: none, truncate to their /24 network or hash")
+	fs.StringVar(&c.HashKey, "hashkey", c.HashKey, "key of the hash of the remote hosts, random at each start if empty")
+	fs.StringVar(&c.Webhook, "webhook", c.Webhook, "URL where alerts are posted as JSON, disabled if empty")
+	fs.StringVar(&c.Slack, "slack", c.Slack, "Slack compatible incoming webhook URL where alerts are posted, disabled if empty")
+	fs.StringVar(&c.SMTP, "smtp", c.SMTP, "host:port of the SMTP server sending alerts by email, disabled if empty")
+	fs.StringVar(&c.SMTPUser, "smtpuser", c.SMTPUser, "SMTP user, the password is read from the SMTP_PASSWORD environment variable")
+	fs.StringVar(&c.MailFrom, "mailfrom", c.MailFrom, "sender of the alert emails")
+	fs.StringVar(&c.MailTo, "mailto", c.MailTo, "recipients of the alert emails separated by commas")
+	fs.IntVar(&c.ShutdownTimeout, "shutdowntimeout", c.ShutdownTimeout, "number of seconds given to send the last statistics and alerts when stopping")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address of a syslog listener fed to the monitor: syslog://:5514 for UDP and TCP, syslog+udp:// or syslog+tcp:// for one of them")
+	fs.StringVar(&c.StateFile, "statefile", c.StateFile, "file where the read position and the alert state are saved, the next start resumes from them")
+	return fs
+}
+
+// LoadFile reads the settings of a YAML or TOML file into c, depending on its extension
+// The settings missing from the file keep their value, an unknown setting is an error
+func (c *Config) LoadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		if err := yaml.UnmarshalStrict(content, c); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), c)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+		for _, key := range meta.Keys() {
+			keys = append(keys, key.String())
+		}
+	default:
+		return fmt.Errorf("%s: unknown config file extension, expected .yml, .yaml or .toml", path)
+	}
+	c.File = path
+	for _, key := range keys {
+		c.set[key] = true
+	}
+	return nil
+}
+
+// loadEnv sets the flags of flags from their LOGMONITOR_* environment variable, if it is not empty
+func (c *Config) loadEnv(flags *flag.FlagSet, getenv func(string) string) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		name := EnvPrefix + strings.ToUpper(f.Name)
+		value := getenv(name)
+		if value == "" {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, name, setErr)
+			return
+		}
+		c.set[f.Name] = true
+	})
+	return err
+}
+
+// IsSet tells whether the setting name has been given by the file, the environment or the flags
+func (c *Config) IsSet(name string) bool {
+	return c.set[name]
+}
+
+// Monitor returns the parameters of the monitor, without its log files and its parser
+func (c *Config) Monitor() monitoring.Config {
+	config := monitoring.Config{
+		TimeWindow:      c.TimeWindow,
+		UpdateInterval:  c.UpdateInterval,
+		Threshold:       c.Threshold,
+		For:             c.For,
+		ReOpenFile:      true,
+		Rotated:         c.Rotated,
+		Lateness:        time.Duration(c.Lateness) * time.Second,
+		ShutdownTimeout: time.Duration(c.ShutdownTimeout) * time.Second,
+		StateFile:       c.StateFile,
+		ErrorPolicy:     monitoring.ErrorPolicy(c.OnError),
+		QuarantineFile:  c.Quarantine,
+		Anonymization:   monitoring.Anonymization(c.Anonymize),
+	}
+	if c.Recover >= 0 {
+		config.RecoverThreshold = c.Recover
+	}
+	if c.HashKey != "" {
+		config.HashKey = []byte(c.HashKey)
+	}
+	return config
+}
+
+// Recipients returns the addresses of MailTo, without the spaces around them nor the empty ones
+func (c *Config) Recipients() []string {
+	var recipients []string
+	for _, recipient := range strings.Split(c.MailTo, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// Validate checks the settings and their combinations, the error names the faulty setting
+func (c *Config) Validate() error {
+	if c.For < 1 {
+		return fmt.Errorf("for must be at least 1, got %d", c.For)
+	}
+	// No traffic is below 0 requests per second, the alert would never recover
+	if c.Recover == 0 {
+		return fmt.Errorf("recover must be at least 1, or negative for the alerting threshold, got 0")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdowntimeout must be a positive number of seconds, got %d", c.ShutdownTimeout)
+	}
+	// The settings of the monitor, the lateness, the error policy and the anonymization included, are checked by it
+	if err := c.Monitor().Validate(); err != nil {
+		return err
+	}
+	if c.Speed < 0 {
+		return fmt.Errorf("speed must not be negative, got %v", c.Speed)
+	}
+	if _, err := monitoring.NewParser(c.Format, c.LogFormat); err != nil {
+		return err
+	}
+	if c.History <= 0 {
+		return fmt.Errorf("history must be a positive number of intervals, got %d", c.History)
+	}
+	if _, err := store.ParseRetention(c.Retention); err != nil {
+		return err
+	}
+	if c.Output != OutputTUI && c.Output != OutputJSON && c.Output != OutputNone {
+		return fmt.Errorf("unknown output %s, expected tui, json or none", c.Output)
+	}
+	if c.Rotated && !c.Replay {
+		return fmt.Errorf("rotated is only used with replay")
+	}
+	if c.Listen != "" && (c.Replay || c.Demo) {
+		return fmt.Errorf("listen cannot be used with replay or demo")
+	}
+	if c.SMTP != "" && len(c.Recipients()) == 0 {
+		return fmt.Errorf("mailto is required to send alerts by email")
+	}
+	return nil
+}
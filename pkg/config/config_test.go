@@ -0,0 +1,166 @@
+package config
+
+import (
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file in a temporary directory and returns its path
+func writeFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// env returns a getenv function reading the given variables
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+// Checks that the file, the environment and the flags override each other in this order
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "monitor.yml", "timewindow: 60\nthreshold: 20\nupdateInterval: 5\noutput: json\n")
+	tomlFile := writeFile(t, "monitor.toml", "timewindow = 60\nthreshold = 20\nupdateInterval = 5\noutput = \"json\"\n")
+
+	tests := []struct {
+		name           string
+		args           []string
+		vars           map[string]string
+		timeWindow     int
+		threshold      int
+		updateInterval int
+		output         string
+	}{
+		{"test0", nil, nil, 120, 10, 10, OutputTUI},
+		{"test1", []string{"-config", yamlFile}, nil, 60, 20, 5, OutputJSON},
+		{"test2", []string{"-config", tomlFile}, nil, 60, 20, 5, OutputJSON},
+		{"test3", nil, map[string]string{"LOGMONITOR_CONFIG": yamlFile}, 60, 20, 5, OutputJSON},
+		{"test4", []string{"-config", yamlFile}, map[string]string{"LOGMONITOR_THRESHOLD": "30", "LOGMONITOR_UPDATEINTERVAL": "10"}, 60, 30, 10, OutputJSON},
+		{"test5", []string{"-config", yamlFile, "-threshold", "40"}, map[string]string{"LOGMONITOR_THRESHOLD": "30"}, 60, 40, 5, OutputJSON},
+		{"test6", []string{"-output", "tui"}, map[string]string{"LOGMONITOR_OUTPUT": "json"}, 120, 10, 10, OutputTUI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load("log-monitor", tt.args, env(tt.vars))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.TimeWindow != tt.timeWindow || got.Threshold != tt.threshold || got.UpdateInterval != tt.updateInterval || got.Output != tt.output {
+				t.Errorf("Load() = %d %d %d %s, want %d %d %d %s", got.TimeWindow, got.Threshold, got.UpdateInterval, got.Output,
+					tt.timeWindow, tt.threshold, tt.updateInterval, tt.output)
+			}
+		})
+	}
+}
+
+// Checks that IsSet only reports the settings given by a source
+func TestConfig_IsSet(t *testing.T) {
+	file := writeFile(t, "monitor.yaml", "listen: syslog://:5514\n")
+	got, err := Load("log-monitor", []string{"-config", file, "-threshold", "20"}, env(map[string]string{"LOGMONITOR_STATEFILE": "state.json"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"listen": true, "threshold": true, "statefile": true, "logfile": false, "timewindow": false} {
+		if got.IsSet(name) != want {
+			t.Errorf("IsSet(%q) = %v, want %v", name, !want, want)
+		}
+	}
+}
+
+// Checks that the invalid settings are reported with the faulty setting
+func TestLoad_errors(t *testing.T) {
+	unknownYAML := writeFile(t, "unknown.yml", "timewindows: 60\n")
+	unknownTOML := writeFile(t, "unknown.toml", "timewindows = 60\n")
+	badExtension := writeFile(t, "monitor.json", "{}")
+
+	tests := []struct {
+		name string
+		args []string
+		vars map[string]string
+		want string
+	}{
+		{"test0", []string{"-timewindow", "125"}, nil, "time window 125s must be a multiple of the update interval 10s"},
+		{"test1", []string{"-updateInterval", "0"}, nil, "update interval must be a positive"},
+		{"test2", []string{"-timewindow", "0"}, nil, "time window must be a positive"},
+		{"test3", nil, map[string]string{"LOGMONITOR_TIMEWINDOW": "abc"}, "LOGMONITOR_TIMEWINDOW"},
+		{"test4", []string{"-config", unknownYAML}, nil, "timewindows"},
+		{"test5", []string{"-config", unknownTOML}, nil, "unknown setting timewindows"},
+		{"test6", []string{"-config", badExtension}, nil, "unknown config file extension"},
+		{"test7", []string{"-recover", "20"}, nil, "recover threshold 20"},
+		{"test8", []string{"-for", "0"}, nil, "for must be at least 1"},
+		{"test9", []string{"-rotated"}, nil, "rotated is only used with replay"},
+		{"test10", []string{"-listen", "syslog://:5514", "-replay"}, nil, "listen cannot be used"},
+		{"test11", []string{"-smtp", "localhost:25"}, nil, "mailto is required"},
+		{"test12", []string{"-output", "xml"}, nil, "unknown output xml"},
+		{"test13", []string{"-onerror", "ignore"}, nil, "unknown error policy"},
+		{"test14", []string{"-shutdowntimeout", "0"}, nil, "shutdowntimeout must be"},
+		{"test15", []string{"-history", "0"}, nil, "history must be a positive"},
+		{"test16", []string{"-retention", "1d=720h"}, nil, "unknown resolution 1d"},
+		{"test17", []string{"-recover", "0"}, nil, "recover must be at least 1"},
+		{"test18", nil, map[string]string{"LOGMONITOR_RECOVER": "0"}, "recover must be at least 1"},
+		{"test19", []string{"-lateness", "-5"}, nil, "lateness must not be negative"},
+		{"test20", []string{"-anonymize", "mask"}, nil, "unknown anonymization"},
+		{"test21", []string{"-smtp", "localhost:25", "-mailto", " , "}, nil, "mailto is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load("log-monitor", tt.args, env(tt.vars))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that the settings of the monitor are all given to it by Monitor
+func TestConfig_Monitor(t *testing.T) {
+	conf, err := Load("log-monitor", []string{"-lateness", "3", "-shutdowntimeout", "7", "-statefile", "state.json", "-onerror", "quarantine",
+		"-quarantine", "bad.log", "-anonymize", "hash", "-hashkey", "secret", "-replay", "-rotated"}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := conf.Monitor()
+	if got.Lateness != 3*time.Second || got.ShutdownTimeout != 7*time.Second || got.StateFile != "state.json" || !got.Rotated {
+		t.Errorf("Monitor() lateness = %v, shutdown timeout = %v, state file = %q, rotated = %v", got.Lateness, got.ShutdownTimeout, got.StateFile, got.Rotated)
+	}
+	if got.ErrorPolicy != monitoring.PolicyQuarantine || got.QuarantineFile != "bad.log" || got.Anonymization != monitoring.AnonymizeHash || string(got.HashKey) != "secret" {
+		t.Errorf("Monitor() error policy = %q, quarantine = %q, anonymization = %q, hash key = %q", got.ErrorPolicy, got.QuarantineFile, got.Anonymization, got.HashKey)
+	}
+}
+
+// Checks that the recipients are trimmed and that the empty ones are skipped
+func TestConfig_Recipients(t *testing.T) {
+	tests := []struct {
+		name   string
+		mailTo string
+		want   []string
+	}{
+		{"test0", "", nil},
+		{"test1", "a@x", []string{"a@x"}},
+		{"test2", "a@x, b@y", []string{"a@x", "b@y"}},
+		{"test3", " a@x ,, b@y ,", []string{"a@x", "b@y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{MailTo: tt.mailTo}
+			if got := c.Recipients(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Recipients() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
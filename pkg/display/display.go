@@ -13,6 +13,9 @@ import (
 	"github.com/mum4k/termdash/widgets/sparkline"
 	"github.com/mum4k/termdash/widgets/text"
 	"log"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -28,9 +31,19 @@ type Display struct {
 	statDisplay *text.Text
 	// alert text displaying the statistics
 	alertDisplay *text.Text
+	// termdash text displaying the latency of the requests
+	latencyDisplay *text.Text
+	// termdash text displaying the top remote hosts and users
+	clientDisplay *text.Text
 	// histogram of the number of requests received
 	// the histogram does not show the number of requests, it just shows the evolution of the traffic
 	histogram *sparkline.SparkLine
+	// mutex for thread safety, the view is switched by the keyboard while statistics are received
+	mutex sync.Mutex
+	// last statistics received, kept to redraw them when the view is switched
+	lastStat monitoring.StatRecord
+	// current view, 0 is the combined view of all files and i the view of the i-th file
+	view int
 	// Global app context
 	ctx context.Context
 	// cancel function for context cancellation
@@ -52,38 +65,69 @@ func New(ctx context.Context, cancel context.CancelFunc, statChan chan monitorin
 	if err != nil {
 		log.Fatal(err)
 	}
+	latencyDisplay, err := text.New(text.WrapAtWords())
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientDisplay, err := text.New(text.WrapAtWords())
+	if err != nil {
+		log.Fatal(err)
+	}
 	histogram, err := sparkline.New(sparkline.Color(cell.ColorCyan))
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	display := &Display{
-		StatChan:      statChan,
-		AlertChan:     alertChan,
-		uptimeDisplay: uptimeDisplay,
-		statDisplay:   statDisplay,
-		alertDisplay:  alertDisplay,
-		histogram:     histogram,
-		ctx:           ctx,
-		cancel:        cancel,
+		StatChan:       statChan,
+		AlertChan:      alertChan,
+		uptimeDisplay:  uptimeDisplay,
+		statDisplay:    statDisplay,
+		alertDisplay:   alertDisplay,
+		latencyDisplay: latencyDisplay,
+		clientDisplay:  clientDisplay,
+		histogram:      histogram,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 	return display
 }
 
+// Preload adds the number of requests of previous intervals to the histogram, such as the ones of the store
+func (d *Display) Preload(requests []int) {
+	if len(requests) > 0 {
+		d.histogram.Add(requests)
+	}
+}
+
 // DisplayPairs displays statistic pairs to the statDisplay
 func (d *Display) DisplayPairs(pairs []monitoring.Pair) {
+	writePairs(d.statDisplay, pairs)
+}
+
+// writePairs writes statistic pairs to a text widget
+func writePairs(widget *text.Text, pairs []monitoring.Pair) {
 	// We iterate i and not on the elements of pairs to always have the same number of lines printed
 	for i := 0; i < 5; i++ {
 		// display each pair on a row
 		if i < len(pairs) {
-			d.statDisplay.Write(fmt.Sprintf("    %s: %d\n", pairs[i].Key, pairs[i].Value))
+			widget.Write(fmt.Sprintf("    %s: %d\n", pairs[i].Key, pairs[i].Value))
 		} else {
 			// display an empty line
-			d.statDisplay.Write(fmt.Sprintf("\n"))
+			widget.Write(fmt.Sprintf("\n"))
 		}
 	}
 }
 
+// DisplayClients displays the top remote hosts and authenticated users on the clientDisplay
+func (d *Display) DisplayClients(stat monitoring.StatRecord) {
+	d.clientDisplay.Reset()
+	d.clientDisplay.Write("Top hosts: \n", text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
+	writePairs(d.clientDisplay, stat.TopHosts)
+	d.clientDisplay.Write("Top users: \n", text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
+	writePairs(d.clientDisplay, stat.TopUsers)
+}
+
 // DisplayInfo displays all the information on the statDisplay:
 // 		The pairs of each section/method/status
 // 		The number of requests
@@ -94,6 +138,12 @@ func (d *Display) DisplayInfo(stat monitoring.StatRecord) {
 	d.statDisplay.Write(fmt.Sprintf("%d\n", stat.NumRequests))
 	d.statDisplay.Write(fmt.Sprintf("Number of bytes transferred: "), text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
 	d.statDisplay.Write(fmt.Sprintf("%s\n", stat.BytesCount))
+	d.statDisplay.Write(fmt.Sprintf("Parse errors: "), text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
+	if stat.ParseErrors > 0 {
+		d.statDisplay.Write(fmt.Sprintf("%d\n", stat.ParseErrors), text.WriteCellOpts(cell.FgColor(cell.ColorRed)))
+	} else {
+		d.statDisplay.Write(fmt.Sprintf("%d\n", stat.ParseErrors))
+	}
 
 	d.statDisplay.Write("\nTop sections: \n", text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
 	d.DisplayPairs(stat.TopSections)
@@ -105,6 +155,93 @@ func (d *Display) DisplayInfo(stat monitoring.StatRecord) {
 	d.DisplayPairs(stat.TopStatus)
 }
 
+// FmtLatency formats a request duration in milliseconds, or in seconds above one second
+func FmtLatency(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// DisplayLatency displays the latency percentiles of the interval and of each top section on the latencyDisplay
+func (d *Display) DisplayLatency(stat monitoring.StatRecord) {
+	d.latencyDisplay.Reset()
+	if stat.Latency == nil {
+		d.latencyDisplay.Write("No request duration in the logs\n")
+		return
+	}
+	d.latencyDisplay.Write(fmt.Sprintf("%-12s %9s %9s %9s %9s\n", "", "p50", "p90", "p99", "max"), text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
+	d.displayLatencyRow("All", *stat.Latency)
+	for _, section := range stat.TopSections {
+		if latency, ok := stat.SectionLatency[section.Key]; ok {
+			d.displayLatencyRow(section.Key, latency)
+		}
+	}
+}
+
+// displayLatencyRow displays the percentiles of a section on a row of the latencyDisplay
+func (d *Display) displayLatencyRow(name string, latency monitoring.Latency) {
+	d.latencyDisplay.Write(fmt.Sprintf("%-12s %9s %9s %9s %9s\n", name, FmtLatency(latency.P50), FmtLatency(latency.P90), FmtLatency(latency.P99), FmtLatency(latency.Max)))
+}
+
+// DisplayRuleAlert displays an alert of an alert rule on the alertDisplay
+func (d *Display) DisplayRuleAlert(alert monitoring.AlertRecord) {
+	if alert.Alert {
+		// Critical alerts are displayed in red, the others in yellow
+		color := cell.ColorYellow
+		if alert.Severity == "critical" {
+			color = cell.ColorRed
+		}
+		d.alertDisplay.Write(fmt.Sprintf("[%s] %s generated an alert - value = %.2f above %.2f, triggered at %s\n", alert.Severity, alert.Rule, alert.Value, alert.Threshold, alert.Time.Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(color)))
+	} else {
+		d.alertDisplay.Write(fmt.Sprintf("[%s] %s has recovered - value = %.2f, triggered at %s\n", alert.Severity, alert.Rule, alert.Value, alert.Time.Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorGreen)))
+	}
+}
+
+// SourceNames returns the sorted names of the files of the per-file breakdown of stat
+func SourceNames(stat monitoring.StatRecord) []string {
+	names := make([]string, 0, len(stat.Sources))
+	for name := range stat.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NextView switches to the view of the next file, after the last file it comes back to the combined view
+func (d *Display) NextView() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.view = (d.view + 1) % (len(d.lastStat.Sources) + 1)
+	d.render()
+}
+
+// render clears the statDisplay and displays the last statistics in the current view
+// the caller must hold the mutex
+func (d *Display) render() {
+	d.statDisplay.Reset()
+	names := SourceNames(d.lastStat)
+	if len(names) == 0 {
+		d.DisplayInfo(d.lastStat)
+		d.DisplayLatency(d.lastStat)
+		d.DisplayClients(d.lastStat)
+		return
+	}
+	// The number of files may have changed
+	if d.view > len(names) {
+		d.view = 0
+	}
+	stat, title := d.lastStat, "all files"
+	if d.view > 0 {
+		stat, title = d.lastStat.Sources[names[d.view-1]], filepath.Base(names[d.view-1])
+	}
+	d.statDisplay.Write("View: ", text.WriteCellOpts(cell.FgColor(cell.ColorYellow)))
+	d.statDisplay.Write(fmt.Sprintf("%s (%d/%d, press V to switch)\n\n", title, d.view+1, len(names)+1))
+	d.DisplayInfo(stat)
+	d.DisplayLatency(stat)
+	d.DisplayClients(stat)
+}
+
 // FmtDuration formats the uptime
 func FmtDuration(d time.Duration) string {
 	// Convert duration to int
@@ -131,23 +268,29 @@ func (d *Display) Update(ctx context.Context) {
 			if ok {
 				// add the number of requests to the histogram
 				d.histogram.Add([]int{info.NumRequests})
-				// Clear the past information
-				d.statDisplay.Reset()
 				// Display new information
-				d.DisplayInfo(info)
+				d.mutex.Lock()
+				d.lastStat = info
+				d.render()
+				d.mutex.Unlock()
 			} else {
 				d.cancel()
 			}
 			// Alert received
 		case alert, ok := <-d.AlertChan:
 			if ok {
-				if alert.Alert {
+				if alert.Reload != "" {
+					// Record the reload of the settings in blue
+					d.alertDisplay.Write(fmt.Sprintf("Settings reloaded - %s, at %s\n", alert.Reload, alert.Time.Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorBlue)))
+				} else if alert.Rule != "" {
+					d.DisplayRuleAlert(alert)
+				} else if alert.Alert {
 					// If alert is true, display it in red
-					d.alertDisplay.Write(fmt.Sprintf("High traffic generated an alert - hits = %d, triggered at %s\n", alert.NumTraffic, time.Now().Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorRed)))
+					d.alertDisplay.Write(fmt.Sprintf("High traffic generated an alert - hits = %d, triggered at %s\n", alert.NumTraffic, alert.Time.Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorRed)))
 
 				} else {
 					// If the alert recovered, display it in green
-					d.alertDisplay.Write(fmt.Sprintf("High traffic has recovered, triggered at %s\n", time.Now().Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorGreen)))
+					d.alertDisplay.Write(fmt.Sprintf("High traffic has recovered, triggered at %s\n", alert.Time.Format("15:04:05, January 02 2006")), text.WriteCellOpts(cell.FgColor(cell.ColorGreen)))
 				}
 			} else {
 				d.cancel()
@@ -164,7 +307,11 @@ func (d *Display) Run() {
 	go d.Update(d.ctx)
 
 	// If q is pressed, exit
+	// If v is pressed, switch between the combined view and the view of each file
 	quitter := func(k *terminalapi.Keyboard) {
+		if k.Key == 'v' || k.Key == 'V' {
+			d.NextView()
+		}
 		if k.Key == 'q' || k.Key == 'Q' {
 			d.cancel()
 		}
@@ -188,9 +335,17 @@ func (d *Display) Run() {
 						container.BorderTitle("Uptime"),
 						container.PlaceWidget(d.uptimeDisplay)),
 					container.Bottom(
-						container.Border(linestyle.Light),
-						container.BorderTitle("Traffic info"),
-						container.PlaceWidget(d.statDisplay)),
+						container.SplitHorizontal(
+							container.Top(
+								container.Border(linestyle.Light),
+								container.BorderTitle("Traffic info"),
+								container.PlaceWidget(d.statDisplay)),
+							container.Bottom(
+								container.Border(linestyle.Light),
+								container.BorderTitle("Latency"),
+								container.PlaceWidget(d.latencyDisplay)),
+							container.SplitPercent(75),
+						)),
 					container.SplitPercent(15),
 				)),
 			container.Right(
@@ -200,9 +355,16 @@ func (d *Display) Run() {
 						container.BorderTitle("Alerts"),
 						container.PlaceWidget(d.alertDisplay)),
 					container.Bottom(
-						container.Border(linestyle.Light),
-						container.BorderTitle("Traffic histogram"),
-						container.PlaceWidget(d.histogram)),
+						container.SplitHorizontal(
+							container.Top(
+								container.Border(linestyle.Light),
+								container.BorderTitle("Top clients"),
+								container.PlaceWidget(d.clientDisplay)),
+							container.Bottom(
+								container.Border(linestyle.Light),
+								container.BorderTitle("Traffic histogram"),
+								container.PlaceWidget(d.histogram)),
+						)),
 				),
 			),
 		))
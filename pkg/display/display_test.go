@@ -75,3 +75,52 @@ func TestDisplay_Run(t *testing.T) {
 		})
 	}
 }
+
+// TestDisplay_NextView checks that the view cycles through the combined view and the view of each file
+func TestDisplay_NextView(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	display := New(ctx, cancel, nil, nil)
+	display.lastStat = monitoring.StatRecord{
+		NumRequests: 3,
+		Sources: map[string]monitoring.StatRecord{
+			"/var/log/b.log": {NumRequests: 1},
+			"/var/log/a.log": {NumRequests: 2},
+		},
+	}
+	if names := SourceNames(display.lastStat); len(names) != 2 || names[0] != "/var/log/a.log" {
+		t.Errorf("SourceNames() = %v", names)
+	}
+	for _, want := range []int{1, 2, 0, 1} {
+		display.NextView()
+		if display.view != want {
+			t.Errorf("NextView() view = %d, want %d", display.view, want)
+		}
+	}
+	// Without breakdown there is only the combined view
+	display.lastStat = monitoring.StatRecord{NumRequests: 3}
+	display.NextView()
+	if display.view != 0 {
+		t.Errorf("NextView() view = %d, want 0", display.view)
+	}
+}
+
+func TestFmtLatency(t *testing.T) {
+	tests := []struct {
+		name  string
+		input time.Duration
+		want  string
+	}{
+		{"test0", 1250 * time.Microsecond, "1.2ms"},
+		{"test1", 250 * time.Millisecond, "250.0ms"},
+		{"test2", 1500 * time.Millisecond, "1.50s"},
+		{"test3", 0, "0.0ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FmtLatency(tt.input); got != tt.want {
+				t.Errorf("FmtLatency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -41,6 +41,15 @@ func RandomByteSize() string {
 	return fmt.Sprintf("%d", rand.Intn(10000))
 }
 
+// RandomDuration generates a random request duration in microseconds, like %D of Apache
+// Most requests take a few milliseconds and a few of them up to a second
+func RandomDuration() string {
+	if rand.Intn(20) == 0 {
+		return fmt.Sprintf("%d", rand.Intn(1000000))
+	}
+	return fmt.Sprintf("%d", 1000+rand.Intn(50000))
+}
+
 // CurrentTime returns current time formatted in the proper format
 func CurrentTime() string {
 	return time.Now().Format("[02/January/2006:15:04:05 -0700]")
@@ -48,7 +57,7 @@ func CurrentTime() string {
 
 // GenerateLog generates the full log line
 func GenerateLog() string {
-	return fmt.Sprintf("%s - %s %s %s %s %s\n", RandomIP(), RandomUser(), CurrentTime(), RandomRequest(), RandomStatus(), RandomByteSize())
+	return fmt.Sprintf("%s - %s %s %s %s %s %s\n", RandomIP(), RandomUser(), CurrentTime(), RandomRequest(), RandomStatus(), RandomByteSize(), RandomDuration())
 }
 
 // WriteLogLine writes a generated log line in the log file
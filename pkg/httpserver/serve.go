@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is the time given to the requests in flight once the server is stopped
+const ShutdownTimeout = time.Second
+
+// Serve serves handler on listener until ctx is cancelled
+// It returns nil once stopped by ctx, and the error of the server if it stopped by itself
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// Checks that Serve serves the handler and returns nil once the context is cancelled
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "ok" {
+		t.Errorf("GET = %q, %v, want ok", body, err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() err = %v", err)
+	}
+}
+
+// Checks that the error of a server that stops by itself is returned
+func TestServe_error(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Serve(ctx, listener, http.NotFoundHandler()); err == nil {
+		t.Errorf("Serve() err = nil, want the error of the closed listener")
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/httpserver"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxSections is the default number of sections having their own label
+const DefaultMaxSections = 20
+
+// OtherSection is the label of the requests of the sections beyond MaxSections
+const OtherSection = "other"
+
+// Exporter is a Sink exposing the statistics of the monitor in the Prometheus text format
+// Counters keep accumulating across the intervals, gauges hold the value of the last interval
+type Exporter struct {
+	// Number of sections having their own label, the requests of the other sections are counted in OtherSection
+	// Each label is a time series of Prometheus, the sections of the URLs are not bounded
+	MaxSections int
+	// mutex for thread safety, the sink and the HTTP server run in different goroutines
+	mutex sync.Mutex
+	// Requests by section, method and status class since the start
+	sections map[string]int
+	methods  map[string]int
+	status   map[string]int
+	// Totals since the start
+	requests    int
+	bytes       int
+	parseErrors int
+	alerts      int
+	// Current alert state and traffic of the alerting window
+	inAlert       bool
+	windowTraffic int
+	// Current alert state of each alert rule, 1 if active
+	rules map[string]int
+}
+
+// New returns an Exporter with all counters at zero
+func New() *Exporter {
+	return &Exporter{
+		MaxSections: DefaultMaxSections,
+		sections:    make(map[string]int),
+		methods:     make(map[string]int),
+		status:      make(map[string]int),
+		rules:       make(map[string]int),
+	}
+}
+
+// WriteStat adds the counts of an interval to the counters
+func (e *Exporter) WriteStat(stat monitoring.StatRecord) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.addSections(stat)
+	addCounts(e.methods, stat.Methods)
+	addCounts(e.status, stat.Status)
+	e.requests += stat.NumRequests
+	e.bytes += stat.NumBytes
+	e.parseErrors += stat.ParseErrors
+	e.windowTraffic = stat.WindowTraffic
+	return nil
+}
+
+// WriteAlert updates the alert state
+func (e *Exporter) WriteAlert(alert monitoring.AlertRecord) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	// A reload of the settings changes no alert
+	if alert.Reload != "" {
+		return nil
+	}
+	if alert.Rule != "" {
+		e.rules[alert.Rule] = 0
+		if alert.Alert {
+			e.rules[alert.Rule] = 1
+		}
+		return nil
+	}
+	e.inAlert = alert.Alert
+	e.windowTraffic = alert.NumTraffic
+	// A resumed alert has already been counted before the restart
+	if alert.Alert && !alert.Resumed {
+		e.alerts++
+	}
+	return nil
+}
+
+// Close does nothing, the last values stay exposed until the server stops
+func (e *Exporter) Close() error {
+	return nil
+}
+
+// addSections adds the requests of each section of an interval
+// A section gets its own label while there are less than MaxSections, the top sections of the interval first
+// Once labeled, a section keeps its label so that its counter never goes back
+func (e *Exporter) addSections(stat monitoring.StatRecord) {
+	labeled := len(e.sections)
+	if _, ok := e.sections[OtherSection]; ok {
+		labeled--
+	}
+	admit := func(section string) {
+		if _, ok := e.sections[section]; !ok && labeled < e.MaxSections {
+			e.sections[section] = 0
+			labeled++
+		}
+	}
+	for _, top := range stat.TopSections {
+		admit(top.Key)
+	}
+	sections := make([]string, 0, len(stat.Sections))
+	for section := range stat.Sections {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		admit(section)
+		if _, ok := e.sections[section]; ok {
+			e.sections[section] += stat.Sections[section]
+		} else {
+			e.sections[OtherSection] += stat.Sections[section]
+		}
+	}
+}
+
+// addCounts adds the counts of src to dst
+func addCounts(dst map[string]int, src map[string]int) {
+	for key, count := range src {
+		dst[key] += count
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	writeLabeled(w, "logmonitor_section_requests_total", "counter", "Number of requests by section.", "section", e.sections)
+	writeLabeled(w, "logmonitor_method_requests_total", "counter", "Number of requests by HTTP method.", "method", e.methods)
+	writeLabeled(w, "logmonitor_status_requests_total", "counter", "Number of requests by HTTP status class.", "class", e.status)
+	writeMetric(w, "logmonitor_requests_total", "counter", "Number of requests.", e.requests)
+	writeMetric(w, "logmonitor_bytes_total", "counter", "Number of bytes transferred.", e.bytes)
+	writeMetric(w, "logmonitor_parse_errors_total", "counter", "Number of log lines that could not be parsed.", e.parseErrors)
+	writeMetric(w, "logmonitor_alerts_total", "counter", "Number of high traffic alerts triggered.", e.alerts)
+	inAlert := 0
+	if e.inAlert {
+		inAlert = 1
+	}
+	writeMetric(w, "logmonitor_alert_active", "gauge", "1 if the high traffic alert is active, 0 otherwise.", inAlert)
+	writeMetric(w, "logmonitor_window_requests", "gauge", "Number of requests in the alerting time window.", e.windowTraffic)
+	writeLabeled(w, "logmonitor_rule_alert_active", "gauge", "1 if the alert rule is active, 0 otherwise.", "rule", e.rules)
+}
+
+// writeMetric writes a metric without labels
+func writeMetric(w io.Writer, name string, kind string, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// writeLabeled writes a metric with one sample for each key of values, sorted by key
+func writeLabeled(w io.Writer, name string, kind string, help string, label string, values map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(key), values[key])
+	}
+}
+
+// labelEscaper escapes the characters that are not allowed in a label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// Serve serves the metrics of the exporter on /metrics until ctx is cancelled
+func Serve(ctx context.Context, listener net.Listener, e *Exporter) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	return httpserver.Serve(ctx, listener, mux)
+}
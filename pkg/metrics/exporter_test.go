@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"context"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the body of a GET on url
+func scrape(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestExporter(t *testing.T) {
+	exporter := New()
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+
+	// Two intervals, the counters must accumulate
+	exporter.WriteStat(monitoring.StatRecord{
+		NumRequests:   3,
+		NumBytes:      1500,
+		Sections:      map[string]int{"/api": 2, "/home": 1},
+		Methods:       map[string]int{"GET": 3},
+		Status:        map[string]int{"2xx": 3},
+		WindowTraffic: 3,
+	})
+	exporter.WriteStat(monitoring.StatRecord{
+		NumRequests:   2,
+		NumBytes:      500,
+		ParseErrors:   1,
+		Sections:      map[string]int{"/api": 1, `/a"b`: 1},
+		Methods:       map[string]int{"POST": 2},
+		Status:        map[string]int{"5xx": 2},
+		WindowTraffic: 5,
+	})
+	exporter.WriteAlert(monitoring.AlertRecord{Alert: true, NumTraffic: 1300})
+	exporter.WriteAlert(monitoring.AlertRecord{Alert: true, Rule: "server errors", Value: 12})
+
+	body := scrape(t, server.URL)
+	for _, want := range []string{
+		`logmonitor_section_requests_total{section="/api"} 3`,
+		`logmonitor_section_requests_total{section="/home"} 1`,
+		`logmonitor_section_requests_total{section="/a\"b"} 1`,
+		`logmonitor_method_requests_total{method="GET"} 3`,
+		`logmonitor_method_requests_total{method="POST"} 2`,
+		`logmonitor_status_requests_total{class="5xx"} 2`,
+		"logmonitor_requests_total 5",
+		"logmonitor_bytes_total 2000",
+		"logmonitor_parse_errors_total 1",
+		"logmonitor_alerts_total 1",
+		"logmonitor_alert_active 1",
+		"logmonitor_window_requests 1300",
+		"# TYPE logmonitor_window_requests gauge",
+		`logmonitor_rule_alert_active{rule="server errors"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics do not contain %q\n%s", want, body)
+		}
+	}
+
+	// The alert recovers
+	exporter.WriteAlert(monitoring.AlertRecord{Alert: false, NumTraffic: 20})
+	if body := scrape(t, server.URL); !strings.Contains(body, "logmonitor_alert_active 0\n") {
+		t.Errorf("metrics should show the recovery\n%s", body)
+	}
+}
+
+// Checks that only MaxSections sections have their own label, the top sections first, and that they keep it
+func TestExporter_maxSections(t *testing.T) {
+	exporter := New()
+	exporter.MaxSections = 2
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+
+	exporter.WriteStat(monitoring.StatRecord{
+		TopSections: []monitoring.Pair{{Key: "/c", Value: 3}, {Key: "/a", Value: 2}},
+		Sections:    map[string]int{"/a": 2, "/b": 1, "/c": 3},
+	})
+	// /b becomes the top section but there is no room left
+	exporter.WriteStat(monitoring.StatRecord{
+		TopSections: []monitoring.Pair{{Key: "/b", Value: 4}},
+		Sections:    map[string]int{"/a": 1, "/b": 4, "/d": 1},
+	})
+
+	body := scrape(t, server.URL)
+	for _, want := range []string{
+		`logmonitor_section_requests_total{section="/a"} 3`,
+		`logmonitor_section_requests_total{section="/c"} 3`,
+		`logmonitor_section_requests_total{section="other"} 6`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics do not contain %q\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `section="/b"`) || strings.Contains(body, `section="/d"`) {
+		t.Errorf("metrics should not have more than 2 sections\n%s", body)
+	}
+}
+
+// Checks that Serve exposes /metrics and stops with the context
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, listener, New())
+	}()
+
+	if body := scrape(t, "http://"+listener.Addr().String()+"/metrics"); !strings.Contains(body, "logmonitor_requests_total 0") {
+		t.Errorf("unexpected metrics\n%s", body)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() err = %v", err)
+	}
+}
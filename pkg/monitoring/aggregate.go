@@ -0,0 +1,86 @@
+package monitoring
+
+// Aggregate holds the running counters of an interval
+// The records are added one by one as they are read, so the monitor does not keep them in memory
+type Aggregate struct {
+	requests int
+	bytes    int
+	// number of requests of each section/method/status class
+	sections map[string]int
+	methods  map[string]int
+	status   map[string]int
+	// Hosts and users may have a high cardinality, they are counted in sketches of bounded size
+	hosts *TopK
+	users *TopK
+	// durations of all requests and of the requests of each section, in histograms of bounded size
+	durations        *Histogram
+	sectionDurations map[string]*Histogram
+}
+
+// NewAggregate returns an empty Aggregate
+func NewAggregate() *Aggregate {
+	return &Aggregate{
+		sections:         make(map[string]int),
+		methods:          make(map[string]int),
+		status:           make(map[string]int),
+		hosts:            NewTopK(DefaultTopKCapacity),
+		users:            NewTopK(DefaultTopKCapacity),
+		durations:        NewHistogram(),
+		sectionDurations: make(map[string]*Histogram),
+	}
+}
+
+// Add updates the counters with a record
+func (a *Aggregate) Add(record *LogRecord) {
+	a.requests++
+	a.bytes += record.bytesCount
+	a.sections[record.section]++
+	a.methods[record.method]++
+	a.status[ProcessStatus(record.status)]++
+	a.hosts.Add(record.remotehost, 1)
+	// A dash means that the user is not authenticated
+	if record.authuser != "-" && record.authuser != "" {
+		a.users.Add(record.authuser, 1)
+	}
+	if record.timed {
+		a.durations.Add(record.duration)
+		if a.sectionDurations[record.section] == nil {
+			a.sectionDurations[record.section] = NewHistogram()
+		}
+		a.sectionDurations[record.section].Add(record.duration)
+	}
+}
+
+// Requests returns the number of records added
+func (a *Aggregate) Requests() int {
+	return a.requests
+}
+
+// Stats returns the statistics of the records added, k is number of lines for each top list
+func (a *Aggregate) Stats(k int) StatRecord {
+	topSections := getTopK(a.sections, k)
+	stat := StatRecord{
+		TopSections: topSections,
+		TopMethods:  getTopK(a.methods, k),
+		TopStatus:   getTopK(a.status, k),
+		TopHosts:    a.hosts.Top(k),
+		TopUsers:    a.users.Top(k),
+		NumRequests: a.requests,
+		BytesCount:  FormatByteCount(a.bytes),
+		Sections:    a.sections,
+		Methods:     a.methods,
+		Status:      a.status,
+		NumBytes:    a.bytes,
+	}
+	if a.durations.Count() > 0 {
+		latency := a.durations.Latency()
+		stat.Latency = &latency
+		stat.SectionLatency = make(map[string]Latency)
+		for _, section := range topSections {
+			if a.sectionDurations[section.Key] != nil {
+				stat.SectionLatency[section.Key] = a.sectionDurations[section.Key].Latency()
+			}
+		}
+	}
+	return stat
+}
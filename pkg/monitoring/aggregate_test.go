@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// aggregateOf returns the Aggregate of records
+func aggregateOf(records []LogRecord) *Aggregate {
+	aggregate := NewAggregate()
+	for i := range records {
+		aggregate.Add(&records[i])
+	}
+	return aggregate
+}
+
+func TestAggregate_Stats(t *testing.T) {
+	records := []LogRecord{
+		{remotehost: "a", authuser: "jill", method: "GET", section: "/api", status: "200", bytesCount: 100, duration: time.Millisecond, timed: true},
+		{remotehost: "a", authuser: "-", method: "POST", section: "/api", status: "201", bytesCount: 200, duration: 3 * time.Millisecond, timed: true},
+		{remotehost: "b", authuser: "-", method: "GET", section: "/home", status: "404", bytesCount: 300},
+	}
+	aggregate := NewAggregate()
+	for i := range records {
+		aggregate.Add(&records[i])
+		if aggregate.Requests() != i+1 {
+			t.Errorf("Requests() = %d, want %d", aggregate.Requests(), i+1)
+		}
+	}
+	want := StatRecord{
+		TopSections:    []Pair{{"/api", 2}, {"/home", 1}},
+		TopMethods:     []Pair{{"GET", 2}, {"POST", 1}},
+		TopStatus:      []Pair{{"2xx", 2}, {"4xx", 1}},
+		TopHosts:       []Pair{{"a", 2}, {"b", 1}},
+		TopUsers:       []Pair{{"jill", 1}},
+		NumRequests:    3,
+		BytesCount:     "600 B",
+		Sections:       map[string]int{"/api": 2, "/home": 1},
+		Methods:        map[string]int{"GET": 2, "POST": 1},
+		Status:         map[string]int{"2xx": 2, "4xx": 1},
+		NumBytes:       600,
+		Latency:        &Latency{2, time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond},
+		SectionLatency: map[string]Latency{"/api": {2, time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond}},
+	}
+	if got := aggregate.Stats(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() \ngot = %v \nwant %v", got, want)
+	}
+	// The statistics are the same as the ones of the whole list of records
+	if got := GetStats(records, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStats() \ngot = %v \nwant %v", got, want)
+	}
+}
+
+// Checks that an interval without request, or without duration, reports no latency instead of zero percentiles
+func TestAggregate_StatsEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []LogRecord
+	}{
+		{"no record", nil},
+		{"no duration", []LogRecord{{remotehost: "a", method: "GET", section: "/api", status: "200"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat := aggregateOf(tt.records).Stats(5)
+			if stat.Latency != nil || stat.SectionLatency != nil {
+				t.Errorf("Stats() latency = %v, %v, want none", stat.Latency, stat.SectionLatency)
+			}
+			if stat.NumRequests != len(tt.records) {
+				t.Errorf("Stats() requests = %d, want %d", stat.NumRequests, len(tt.records))
+			}
+		})
+	}
+	if got := NewHistogram().Latency(); got != (Latency{}) {
+		t.Errorf("Latency() of an empty histogram = %v, want the zero Latency", got)
+	}
+}
+
+// benchmarkRecords returns n records of 20 sections and 1000 hosts
+func benchmarkRecords(n int) []LogRecord {
+	records := make([]LogRecord, n)
+	for i := range records {
+		records[i] = LogRecord{
+			remotehost: "10.0.0." + strconv.Itoa(i%1000),
+			authuser:   "-",
+			method:     "GET",
+			section:    "/api" + strconv.Itoa(i%20),
+			status:     "200",
+			bytesCount: 100,
+		}
+	}
+	return records
+}
+
+// BenchmarkAggregate_buffered is the baseline: it keeps every record of an interval, then aggregates them in one pass
+func BenchmarkAggregate_buffered(b *testing.B) {
+	records := benchmarkRecords(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buffer []LogRecord
+		for _, record := range records {
+			buffer = append(buffer, record)
+		}
+		GetStats(buffer, 5)
+	}
+}
+
+// BenchmarkAggregate_incremental updates the counters of an interval as the records are read
+func BenchmarkAggregate_incremental(b *testing.B) {
+	records := benchmarkRecords(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aggregate := NewAggregate()
+		for j := range records {
+			aggregate.Add(&records[j])
+		}
+		aggregate.Stats(5)
+	}
+}
@@ -0,0 +1,66 @@
+package monitoring
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+)
+
+// Anonymization tells the monitor how the remote hosts are anonymised before being aggregated
+type Anonymization string
+
+const (
+	// AnonymizeNone keeps the remote hosts as they are logged
+	AnonymizeNone Anonymization = "none"
+	// AnonymizeTruncate keeps the /24 network of IPv4 addresses and the /48 network of IPv6 addresses
+	// host names, which cannot be truncated, are hashed
+	AnonymizeTruncate Anonymization = "truncate"
+	// AnonymizeHash replaces the remote hosts by a keyed hash
+	AnonymizeHash Anonymization = "hash"
+)
+
+// ParseAnonymization returns the Anonymization with the given name
+func ParseAnonymization(name string) (Anonymization, error) {
+	switch anonymization := Anonymization(name); anonymization {
+	case AnonymizeNone, AnonymizeTruncate, AnonymizeHash:
+		return anonymization, nil
+	}
+	return "", fmt.Errorf("unknown anonymization %q, expected none, truncate or hash", name)
+}
+
+// AnonymizeHost anonymises a remote host with the given mode
+// key is the key of the hash, the same host always gives the same hash with the same key
+func AnonymizeHost(host string, mode Anonymization, key []byte) string {
+	switch mode {
+	case AnonymizeTruncate:
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return hashHost(host, key)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	case AnonymizeHash:
+		return hashHost(host, key)
+	}
+	return host
+}
+
+// hashHost returns the first 16 hexadecimal digits of the HMAC-SHA256 of host
+// A plain hash would be easy to reverse as there are only 2^32 IPv4 addresses
+func hashHost(host string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(host))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// randomKey returns a random key for the hash of the remote hosts
+func randomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
@@ -0,0 +1,62 @@
+package monitoring
+
+import "testing"
+
+func TestAnonymizeHost(t *testing.T) {
+	key := []byte("key")
+	tests := []struct {
+		name string
+		host string
+		mode Anonymization
+		want string
+	}{
+		{"test0", "53.120.219.15", AnonymizeNone, "53.120.219.15"},
+		{"test1", "53.120.219.15", AnonymizeTruncate, "53.120.219.0"},
+		{"test2", "2001:db8:85a3::8a2e:370:7334", AnonymizeTruncate, "2001:db8:85a3::"},
+		{"test3", "example.com", AnonymizeTruncate, hashHost("example.com", key)},
+		{"test4", "53.120.219.15", AnonymizeHash, hashHost("53.120.219.15", key)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnonymizeHost(tt.host, tt.mode, key); got != tt.want {
+				t.Errorf("AnonymizeHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that a hash only depends on the host and the key
+func Test_hashHost(t *testing.T) {
+	first := hashHost("53.120.219.15", []byte("key"))
+	if len(first) != 16 || first == "53.120.219.15" {
+		t.Errorf("hashHost() = %v", first)
+	}
+	if hashHost("53.120.219.15", []byte("key")) != first {
+		t.Errorf("hashHost() is not deterministic")
+	}
+	if hashHost("53.120.219.16", []byte("key")) == first || hashHost("53.120.219.15", []byte("other")) == first {
+		t.Errorf("hashHost() collides")
+	}
+}
+
+func TestParseAnonymization(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Anonymization
+		wantErr bool
+	}{
+		{"test0", "none", AnonymizeNone, false},
+		{"test1", "truncate", AnonymizeTruncate, false},
+		{"test2", "hash", AnonymizeHash, false},
+		{"test3", "mask", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAnonymization(tt.input)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParseAnonymization() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decompressor reads a compressed log file, closing it closes the decompressor and the file
+type decompressor struct {
+	io.Reader
+	file  *os.File
+	close func()
+}
+
+// Close closes the decompressor and the file
+func (d *decompressor) Close() error {
+	d.close()
+	return d.file.Close()
+}
+
+// OpenLog opens a log file for reading, the files ending with .gz or .zst are decompressed on the fly
+// StdinName opens the standard input
+func OpenLog(path string) (io.ReadCloser, error) {
+	if path == StdinName {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".gz":
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &decompressor{Reader: reader, file: file, close: func() { reader.Close() }}, nil
+	case ".zst":
+		// A single goroutine is enough as the lines are read one by one
+		reader, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &decompressor{Reader: reader, file: file, close: reader.Close}, nil
+	}
+	return file, nil
+}
+
+// RotatedFiles returns the files of the rotated series of a log file in chronological order
+// The archives written by logrotate are path.1, path.2.gz, path.3.zst and so on, the highest number is the oldest
+// path itself comes last, it is omitted if it does not exist
+func RotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	numbers := make(map[string]int, len(matches))
+	var files []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, path+".")
+		suffix = strings.TrimSuffix(strings.TrimSuffix(suffix, ".gz"), ".zst")
+		n, err := strconv.Atoi(suffix)
+		if err != nil || n < 0 {
+			// Not an archive of the series
+			continue
+		}
+		numbers[match] = n
+		files = append(files, match)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return numbers[files[i]] > numbers[files[j]]
+	})
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("file %s does not exist.", path)
+	}
+	return files, nil
+}
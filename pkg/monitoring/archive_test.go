@@ -0,0 +1,132 @@
+package monitoring
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// compress rewrites the file at path compressed according to ext, .gz or .zst, and removes it
+func compress(t *testing.T, path string, ext string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path + ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var writer io.WriteCloser
+	if ext == ".gz" {
+		writer = gzip.NewWriter(file)
+	} else if writer, err = zstd.NewWriter(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+}
+
+// Checks that the compressed files are decompressed
+func TestOpenLog(t *testing.T) {
+	dir := tempDir(t)
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{"test0", ""},
+		{"test1", ".gz"},
+		{"test2", ".zst"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".log")
+			if err := ioutil.WriteFile(path, []byte("line 1\nline 2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.ext != "" {
+				compress(t, path, tt.ext)
+			}
+			reader, err := OpenLog(path + tt.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			if data, err := ioutil.ReadAll(reader); err != nil || string(data) != "line 1\nline 2\n" {
+				t.Errorf("OpenLog() read %q, %v", data, err)
+			}
+		})
+	}
+}
+
+// Checks that the archives are listed from the oldest and that the other files are ignored
+func TestRotatedFiles(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "access.log")
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2.gz", "access.log.10.zst", "access.log.3", "access.log.bak", "access.log.1.old", "other.log.4"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{path + ".10.zst", path + ".3", path + ".2.gz", path + ".1", path}
+	if got, err := RotatedFiles(path); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("RotatedFiles() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := RotatedFiles(filepath.Join(dir, "missing.log")); err == nil {
+		t.Errorf("RotatedFiles() should fail without any file")
+	}
+}
+
+// Checks that a rotated series is replayed in chronological order as a single file
+func TestLogMonitor_ReplayRotated(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "access.log")
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	// One archive per 5s interval, the oldest has the highest number
+	series := []struct {
+		suffix string
+		ext    string
+		counts []int
+	}{
+		{".3", ".zst", []int{1, 2, 0, 0, 1}},
+		{".2", ".gz", []int{0, 0, 0, 0, 0, 3, 3}},
+		{".1", "", []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5}},
+		{"", "", []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7}},
+	}
+	for _, segment := range series {
+		writeReplayLog(t, path+segment.suffix, start, segment.counts)
+		if segment.ext != "" {
+			compress(t, path+segment.suffix, segment.ext)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{path}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, make(chan AlertRecord, 10))
+	monitor.Rotated = true
+	monitor.Replay(0)
+	if err := monitor.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []int
+	for stat := range statChan {
+		stats = append(stats, stat.NumRequests)
+	}
+	if want := []int{4, 6, 5, 7}; !reflect.DeepEqual(stats, want) {
+		t.Errorf("Replay() sent %v requests, want %v", stats, want)
+	}
+}
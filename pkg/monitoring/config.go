@@ -0,0 +1,108 @@
+package monitoring
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the parameters of a LogMonitor given to New
+type Config struct {
+	// The log files to read, StdinName reads the standard input
+	LogFiles []string
+	// Parser of the log lines, the Common Log Format if nil
+	Parser Parser
+	// Time window for the alerting in seconds, it must be a multiple of UpdateInterval
+	TimeWindow int
+	// Number of seconds between each statistic update
+	UpdateInterval int
+	// Maximum number of request per second before alerting
+	Threshold int
+	// Number of request per second below which the alert recovers, Threshold if 0
+	RecoverThreshold int
+	// Number of consecutive intervals the threshold must be crossed before alerting or recovering, 1 if 0
+	For int
+	// Follow the next file created at the same path once the file is moved or deleted
+	ReOpenFile bool
+	// Replay the rotated archives of each log file before it, see RotatedFiles
+	Rotated bool
+	// Time to wait after the end of an interval before closing it, to let delayed lines arrive
+	Lateness time.Duration
+	// Maximum time spent sending the last statistics once the monitor is cancelled, DefaultShutdownTimeout if 0
+	ShutdownTimeout time.Duration
+	// File where the State of the monitor is saved, disabled if empty
+	StateFile string
+	// What to do with malformed lines, PolicyCount if empty
+	ErrorPolicy ErrorPolicy
+	// File where malformed lines are appended with PolicyQuarantine
+	QuarantineFile string
+	// How the remote hosts are anonymised, AnonymizeNone if empty
+	Anonymization Anonymization
+	// Key of the hash of the remote hosts, random if empty so that the hashes change at each start
+	HashKey []byte
+}
+
+// Validate checks that the parameters can be used by a LogMonitor
+func (c Config) Validate() error {
+	if c.UpdateInterval <= 0 {
+		return fmt.Errorf("the update interval must be a positive number of seconds, got %d", c.UpdateInterval)
+	}
+	if c.TimeWindow <= 0 {
+		return fmt.Errorf("the time window must be a positive number of seconds, got %d", c.TimeWindow)
+	}
+	// The alerting window is made of whole intervals
+	if c.TimeWindow%c.UpdateInterval != 0 {
+		return fmt.Errorf("the time window %ds must be a multiple of the update interval %ds", c.TimeWindow, c.UpdateInterval)
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("the threshold must not be negative, got %d", c.Threshold)
+	}
+	if c.RecoverThreshold < 0 || c.RecoverThreshold > c.Threshold {
+		return fmt.Errorf("the recover threshold %d must be between 0 and the alerting threshold %d", c.RecoverThreshold, c.Threshold)
+	}
+	if c.For < 0 {
+		return fmt.Errorf("for must be a positive number of intervals, got %d", c.For)
+	}
+	if c.Lateness < 0 {
+		return fmt.Errorf("the lateness must not be negative, got %v", c.Lateness)
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("the shutdown timeout must not be negative, got %v", c.ShutdownTimeout)
+	}
+	if c.ErrorPolicy != "" {
+		if _, err := ParseErrorPolicy(string(c.ErrorPolicy)); err != nil {
+			return err
+		}
+	}
+	if c.ErrorPolicy == PolicyQuarantine && c.QuarantineFile == "" {
+		return fmt.Errorf("the quarantine error policy needs a quarantine file")
+	}
+	if c.Anonymization != "" {
+		if _, err := ParseAnonymization(string(c.Anonymization)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withDefaults returns the config with the defaults of the unset optional parameters
+func (c Config) withDefaults() Config {
+	if c.Parser == nil {
+		c.Parser = CommonParser{}
+	}
+	if c.RecoverThreshold == 0 {
+		c.RecoverThreshold = c.Threshold
+	}
+	if c.For == 0 {
+		c.For = 1
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if c.ErrorPolicy == "" {
+		c.ErrorPolicy = PolicyCount
+	}
+	if c.Anonymization == "" {
+		c.Anonymization = AnonymizeNone
+	}
+	return c
+}
@@ -0,0 +1,80 @@
+package monitoring
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMonitor returns the LogMonitor of config, the test fails if config is not valid
+func newMonitor(tb testing.TB, ctx context.Context, cancel context.CancelFunc, config Config, statChan chan StatRecord, alertChan chan AlertRecord) *LogMonitor {
+	tb.Helper()
+	monitor, err := New(ctx, cancel, config, statChan, alertChan)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return monitor
+}
+
+// Checks that the invalid configurations are rejected with an explicit error
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"test0", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10}, ""},
+		{"test1", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, RecoverThreshold: 5, For: 3}, ""},
+		{"test2", Config{TimeWindow: 120, Threshold: 10}, "update interval must be a positive"},
+		{"test3", Config{UpdateInterval: 10, Threshold: 10}, "time window must be a positive"},
+		{"test4", Config{TimeWindow: 125, UpdateInterval: 10, Threshold: 10}, "125s must be a multiple of the update interval 10s"},
+		{"test5", Config{TimeWindow: 5, UpdateInterval: 10, Threshold: 10}, "must be a multiple"},
+		{"test6", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: -1}, "threshold must not be negative"},
+		{"test7", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, RecoverThreshold: 11}, "recover threshold 11"},
+		{"test8", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, For: -1}, "for must be"},
+		{"test9", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, Lateness: -time.Second}, "lateness must not be negative"},
+		{"test10", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, ShutdownTimeout: -time.Second}, "shutdown timeout must not be negative"},
+		{"test11", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, ErrorPolicy: "ignore"}, "unknown error policy"},
+		{"test12", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, ErrorPolicy: PolicyQuarantine}, "needs a quarantine file"},
+		{"test13", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, Anonymization: "mask"}, "unknown anonymization"},
+		{"test14", Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, ErrorPolicy: PolicyQuarantine, QuarantineFile: "q.log", Anonymization: AnonymizeHash, Lateness: time.Second}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Checks the defaults of New and that an invalid configuration gives no monitor
+func TestNew(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := newMonitor(t, ctx, cancel, Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10}, nil, nil)
+	if len(monitor.AlertTraffic) != 12 || monitor.RecoverThreshold != 10 || monitor.For != 1 {
+		t.Errorf("New() window = %d, recover = %d, for = %d, want 12, 10, 1", len(monitor.AlertTraffic), monitor.RecoverThreshold, monitor.For)
+	}
+	if _, ok := monitor.Parser.(CommonParser); !ok {
+		t.Errorf("New() parser = %T, want CommonParser", monitor.Parser)
+	}
+	if monitor.ErrorPolicy != PolicyCount || monitor.Anonymization != AnonymizeNone || monitor.ShutdownTimeout != DefaultShutdownTimeout || len(monitor.HashKey) == 0 {
+		t.Errorf("New() error policy = %q, anonymization = %q, shutdown timeout = %v, hash key = %v", monitor.ErrorPolicy, monitor.Anonymization, monitor.ShutdownTimeout, monitor.HashKey)
+	}
+	config := Config{TimeWindow: 120, UpdateInterval: 10, Threshold: 10, Lateness: time.Second, StateFile: "state.json", HashKey: []byte("key")}
+	if monitor := newMonitor(t, ctx, cancel, config, nil, nil); monitor.Lateness != time.Second || monitor.StateFile != "state.json" || string(monitor.HashKey) != "key" {
+		t.Errorf("New() lateness = %v, state file = %q, hash key = %q", monitor.Lateness, monitor.StateFile, monitor.HashKey)
+	}
+	if monitor, err := New(ctx, cancel, Config{TimeWindow: 120}, nil, nil); err == nil || monitor != nil {
+		t.Errorf("New() = %v, %v, want an error", monitor, err)
+	}
+}
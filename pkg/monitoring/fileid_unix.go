@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package monitoring
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the device and the inode of a file
+func fileIdentity(info os.FileInfo) (uint64, uint64) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(stat.Dev), uint64(stat.Ino)
+}
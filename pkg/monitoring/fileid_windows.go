@@ -0,0 +1,8 @@
+package monitoring
+
+import "os"
+
+// fileIdentity returns no identity, the rotation of a file is only detected when it gets shorter
+func fileIdentity(info os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
@@ -0,0 +1,113 @@
+package monitoring
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// histogramSubBuckets is the number of buckets of each power of two of the histogram
+// The durations below 2*histogramSubBuckets microseconds are exact, the others are within 1/histogramSubBuckets
+const histogramSubBuckets = 64
+
+// histogramShift is the number of bits of histogramSubBuckets
+const histogramShift = 6
+
+// Histogram counts durations in buckets of fixed bounds to give their percentiles
+// The buckets are exact below 128µs, then each power of two is split into 64 buckets, so a percentile is within 1.6%
+// of the exact one. Its size only depends on the range of the durations, not on their number
+type Histogram struct {
+	// number of durations of each bucket, only the buckets used are kept
+	counts   map[int]int
+	count    int
+	min, max time.Duration
+}
+
+// NewHistogram returns an empty Histogram
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make(map[int]int)}
+}
+
+// histogramBucket returns the bucket of a duration
+func histogramBucket(d time.Duration) int {
+	v := uint64(0)
+	if d > 0 {
+		v = uint64(d / time.Microsecond)
+	}
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+	// v>>shift is in [histogramSubBuckets, 2*histogramSubBuckets)
+	shift := bits.Len64(v) - histogramShift - 1
+	return shift*histogramSubBuckets + int(v>>uint(shift))
+}
+
+// histogramLower returns the lower bound of a bucket
+func histogramLower(bucket int) time.Duration {
+	if bucket < 2*histogramSubBuckets {
+		return time.Duration(bucket) * time.Microsecond
+	}
+	shift := bucket/histogramSubBuckets - 1
+	v := uint64(bucket%histogramSubBuckets+histogramSubBuckets) << uint(shift)
+	return time.Duration(v) * time.Microsecond
+}
+
+// Add counts a duration
+func (h *Histogram) Add(d time.Duration) {
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if h.count == 0 || d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.counts[histogramBucket(d)]++
+}
+
+// Count returns the number of durations added
+func (h *Histogram) Count() int {
+	return h.count
+}
+
+// Latency returns the p50/p90/p99/max of the durations added, the zero Latency if there is none
+// A percentile is the lower bound of its bucket, the max for the bucket of the max, which is exact
+func (h *Histogram) Latency() Latency {
+	if h.count == 0 {
+		return Latency{}
+	}
+	buckets := make([]int, 0, len(h.counts))
+	for bucket := range h.counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+	return Latency{
+		Count: h.count,
+		P50:   h.percentile(buckets, 50),
+		P90:   h.percentile(buckets, 90),
+		P99:   h.percentile(buckets, 99),
+		Max:   h.max,
+	}
+}
+
+// percentile returns the p-th percentile with the nearest-rank method, buckets are the buckets used in increasing order
+func (h *Histogram) percentile(buckets []int, p int) time.Duration {
+	rank := (p*h.count + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for _, bucket := range buckets {
+		seen += h.counts[bucket]
+		if seen < rank {
+			continue
+		}
+		if bucket == histogramBucket(h.max) {
+			return h.max
+		}
+		if lower := histogramLower(bucket); lower > h.min {
+			return lower
+		}
+		return h.min
+	}
+	return h.max
+}
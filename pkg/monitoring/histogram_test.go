@@ -0,0 +1,94 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+)
+
+// approxLatency tells whether the percentiles of got are within 1/64 of the ones of want, Count and Max are exact
+func approxLatency(got, want Latency) bool {
+	approx := func(got, want time.Duration) bool {
+		diff := got - want
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff <= want/histogramSubBuckets
+	}
+	return got.Count == want.Count && got.Max == want.Max &&
+		approx(got.P50, want.P50) && approx(got.P90, want.P90) && approx(got.P99, want.P99)
+}
+
+// durationRange returns the durations 1 to n in a shuffled order
+func durationRange(n int) []time.Duration {
+	durations := make([]time.Duration, n)
+	for i := range durations {
+		durations[i] = time.Duration((i*7)%n + 1)
+	}
+	return durations
+}
+
+// Checks that the buckets follow each other and that their bounds are within 1/64 of the durations
+func Test_histogramBucket(t *testing.T) {
+	for bucket := 0; bucket < 40*histogramSubBuckets; bucket++ {
+		if got := histogramBucket(histogramLower(bucket)); got != bucket {
+			t.Fatalf("histogramBucket(%v) = %d, want %d", histogramLower(bucket), got, bucket)
+		}
+	}
+	previous := 0
+	for d := time.Duration(0); d < 10*time.Second; d += d/100 + time.Microsecond {
+		bucket := histogramBucket(d)
+		if bucket < previous {
+			t.Fatalf("histogramBucket(%v) = %d after %d", d, bucket, previous)
+		}
+		previous = bucket
+		lower := histogramLower(bucket)
+		if lower > d || d-lower > d/histogramSubBuckets+time.Microsecond {
+			t.Fatalf("histogramLower(%d) = %v, the bucket of %v", bucket, lower, d)
+		}
+	}
+}
+
+func TestHistogram_Latency(t *testing.T) {
+	// milliseconds returns the durations of durationRange in milliseconds
+	milliseconds := func(n int) []time.Duration {
+		durations := durationRange(n)
+		for i := range durations {
+			durations[i] *= time.Millisecond
+		}
+		return durations
+	}
+	tests := []struct {
+		name  string
+		input []time.Duration
+		want  Latency
+	}{
+		{"test0", nil, Latency{}},
+		{"test1", []time.Duration{time.Second}, Latency{1, time.Second, time.Second, time.Second, time.Second}},
+		{"test2", []time.Duration{3 * time.Microsecond, time.Microsecond, 2 * time.Microsecond, 4 * time.Microsecond}, Latency{4, 2 * time.Microsecond, 4 * time.Microsecond, 4 * time.Microsecond, 4 * time.Microsecond}},
+		{"test3", milliseconds(100), Latency{100, 50 * time.Millisecond, 90 * time.Millisecond, 99 * time.Millisecond, 100 * time.Millisecond}},
+		{"test4", milliseconds(1000), Latency{1000, 500 * time.Millisecond, 900 * time.Millisecond, 990 * time.Millisecond, time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histogram := NewHistogram()
+			for _, d := range tt.input {
+				histogram.Add(d)
+			}
+			if got := histogram.Latency(); !approxLatency(got, tt.want) {
+				t.Errorf("Latency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that the size of the histogram does not grow with the number of durations
+func TestHistogram_size(t *testing.T) {
+	histogram := NewHistogram()
+	for i := 0; i < 1000000; i++ {
+		histogram.Add(time.Duration(i%5000) * time.Millisecond)
+	}
+	// 5s span 23 powers of two of microseconds, of 64 buckets each
+	if len(histogram.counts) > 23*histogramSubBuckets {
+		t.Errorf("the histogram has %d buckets", len(histogram.counts))
+	}
+}
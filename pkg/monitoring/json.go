@@ -0,0 +1,142 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONFields gives the key of each field of a JSON log line
+// Nested objects are reached with dots, "request.method" reads {"request": {"method": "GET"}}
+// Request is used to read the method, path and protocol from a single request line when Method is empty
+type JSONFields struct {
+	RemoteHost string
+	AuthUser   string
+	Date       string
+	Request    string
+	Method     string
+	Path       string
+	Protocol   string
+	Status     string
+	Bytes      string
+	Referer    string
+	UserAgent  string
+	// Duration of the request in seconds
+	Duration string
+}
+
+// DefaultJSONFields are the keys of a JSON log written with nginx variable names
+var DefaultJSONFields = JSONFields{
+	RemoteHost: "remote_addr",
+	AuthUser:   "remote_user",
+	Date:       "time",
+	Request:    "request",
+	Status:     "status",
+	Bytes:      "body_bytes_sent",
+	Referer:    "http_referer",
+	UserAgent:  "http_user_agent",
+	Duration:   "request_time",
+}
+
+// CaddyJSONFields are the keys of the access logs of Caddy
+var CaddyJSONFields = JSONFields{
+	RemoteHost: "request.remote_ip",
+	AuthUser:   "user_id",
+	Date:       "ts",
+	Method:     "request.method",
+	Path:       "request.uri",
+	Protocol:   "request.proto",
+	Status:     "status",
+	Bytes:      "size",
+	Referer:    "request.headers.Referer",
+	UserAgent:  "request.headers.User-Agent",
+	Duration:   "duration",
+}
+
+// JSONParser parses log lines written as one JSON object per line
+type JSONParser struct {
+	fields JSONFields
+}
+
+// NewJSONParser returns a JSONParser reading the given fields
+func NewJSONParser(fields JSONFields) *JSONParser {
+	return &JSONParser{fields: fields}
+}
+
+// Parse parses a JSON log line
+func (p *JSONParser) Parse(line string) (*LogRecord, error) {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		return nil, errInvalidFormat
+	}
+	record := &LogRecord{
+		remotehost: jsonString(object, p.fields.RemoteHost),
+		rfc931:     "-",
+		authuser:   jsonString(object, p.fields.AuthUser),
+		method:     jsonString(object, p.fields.Method),
+		protocol:   jsonString(object, p.fields.Protocol),
+		status:     jsonString(object, p.fields.Status),
+		bytesCount: parseBytes(jsonString(object, p.fields.Bytes)),
+		referer:    jsonString(object, p.fields.Referer),
+		userAgent:  jsonString(object, p.fields.UserAgent),
+	}
+	date, err := parseDate(jsonString(object, p.fields.Date))
+	if err != nil {
+		return nil, err
+	}
+	record.date = date
+	if duration := jsonString(object, p.fields.Duration); duration != "" {
+		record.duration, record.timed = parseSeconds(duration)
+	}
+	path := jsonString(object, p.fields.Path)
+	if record.method == "" {
+		method, requestPath, protocol, err := splitRequest(jsonString(object, p.fields.Request))
+		if err != nil {
+			return nil, err
+		}
+		record.method, path, record.protocol = method, requestPath, protocol
+	}
+	if path == "" || record.status == "" {
+		return nil, errInvalidFormat
+	}
+	if record.authuser == "" {
+		record.authuser = "-"
+	}
+	record.section = Section(path)
+	return record, nil
+}
+
+// jsonString returns the value found at the dotted key as a string
+// An empty key or a missing value gives an empty string
+func jsonString(object map[string]interface{}, key string) string {
+	if key == "" {
+		return ""
+	}
+	var value interface{} = object
+	for _, part := range strings.Split(key, ".") {
+		current, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = current[part]; !ok {
+			return ""
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		// Headers are logged as lists of values by Caddy
+		if len(v) > 0 {
+			return fmt.Sprint(v[0])
+		}
+		return ""
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
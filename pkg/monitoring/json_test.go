@@ -0,0 +1,79 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJSONParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  JSONFields
+		input   string
+		want    *LogRecord
+		wantErr bool
+	}{
+		{"test0",
+			DefaultJSONFields,
+			`{"remote_addr":"10.0.0.1","remote_user":"","time":"2020-03-27T12:16:36+01:00","request":"GET /api/users/1 HTTP/1.1","status":200,"body_bytes_sent":"512","http_referer":"-","http_user_agent":"curl/7.68.0"}`,
+			&LogRecord{
+				remotehost: "10.0.0.1",
+				rfc931:     "-",
+				authuser:   "-",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
+				method:     "GET",
+				section:    "/api",
+				protocol:   "HTTP/1.1",
+				status:     "200",
+				bytesCount: 512,
+				referer:    "-",
+				userAgent:  "curl/7.68.0",
+			},
+			false,
+		},
+		{"test1",
+			CaddyJSONFields,
+			`{"level":"info","ts":1585307796.5,"logger":"http.log.access","msg":"handled request","request":{"remote_ip":"10.0.0.3","proto":"HTTP/2.0","method":"DELETE","host":"example.com","uri":"/cart/item/3","headers":{"User-Agent":["Firefox"]}},"user_id":"jill","duration":0.0125,"size":0,"status":204}`,
+			&LogRecord{
+				remotehost: "10.0.0.3",
+				rfc931:     "-",
+				authuser:   "jill",
+				date:       time.Unix(1585307796, 500000000),
+				method:     "DELETE",
+				section:    "/cart",
+				protocol:   "HTTP/2.0",
+				status:     "204",
+				bytesCount: 0,
+				userAgent:  "Firefox",
+				duration:   12500 * time.Microsecond,
+				timed:      true,
+			},
+			false,
+		},
+		// Not a JSON line
+		{"test2",
+			DefaultJSONFields,
+			"53.120.219.15 - paul [27/March/2020:12:10:41 +0100] \"GET /posts/r/a/view.html HTTP/1.0\" 403 5026",
+			nil,
+			true,
+		},
+		// Missing request
+		{"test3",
+			DefaultJSONFields,
+			`{"remote_addr":"10.0.0.1","status":200}`,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewJSONParser(tt.fields).Parse(tt.input)
+			if !sameRecord(got, tt.want) {
+				t.Errorf("Parse() \ngot = %v \nwant %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,20 +2,60 @@ package monitoring
 
 import (
 	"context"
-	"github.com/hpcloud/tail"
-	"log"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
 
 const sleepTime = 50
 
+// ErrorPolicy tells the monitor what to do with the lines it is not able to parse
+type ErrorPolicy string
+
+const (
+	// PolicySkip drops malformed lines silently
+	PolicySkip ErrorPolicy = "skip"
+	// PolicyCount drops malformed lines and counts them in the ParseErrors of the StatRecord
+	PolicyCount ErrorPolicy = "count"
+	// PolicyQuarantine counts malformed lines and appends them to the quarantine file
+	PolicyQuarantine ErrorPolicy = "quarantine"
+	// PolicyAbort stops the monitor at the first malformed line
+	PolicyAbort ErrorPolicy = "abort"
+)
+
+// ParseErrorPolicy returns the ErrorPolicy with the given name
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	switch policy := ErrorPolicy(name); policy {
+	case PolicySkip, PolicyCount, PolicyQuarantine, PolicyAbort:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown error policy %q, expected skip, count, quarantine or abort", name)
+}
+
+// linesBuffer is the number of parsed lines the readers can send before waiting for the monitor
+const linesBuffer = 1024
+
+// reopenPoll is the delay between two checks for a new log file once the previous one has been moved or deleted
+const reopenPoll = 250 * time.Millisecond
+
+// DefaultShutdownTimeout is the default time given to the monitor to send its last statistics once cancelled
+const DefaultShutdownTimeout = 5 * time.Second
+
 // LogMonitor listens to the log file and retrieves new logs
 // Computes the statistics of the new logs and sends them to the display
 // Sends Alert whenever the threshold is exceeded or recovers
+// The state of the monitor is owned by the goroutine of Run or Replay, the goroutines reading the files
+// send it the parsed lines over a channel
 type LogMonitor struct {
-	// The log file to read
-	LogFile string
+	// The log files to read, StdinName reads the standard input
+	LogFiles []string
+	// Sources read besides the LogFiles
+	Sources []LineSource
+	// Parser of the log lines, depends on the format of the log file
+	Parser Parser
 	// Time window for the alerting in seconds
 	// TimeWindow*Threshold gives the maximum number of logs before alerting (by default 120*10=1200 logs in 2min)
 	TimeWindow int
@@ -25,133 +65,625 @@ type LogMonitor struct {
 	InAlert bool
 	// Maximum number of request per second before alerting
 	Threshold int
-	// Current LogRecords
-	LogRecords []LogRecord
+	// Number of request per second below which the alert recovers, Threshold by default
+	// A value below Threshold avoids a flood of alerts when the traffic hovers around the threshold
+	RecoverThreshold int
+	// Number of consecutive intervals the threshold must be crossed before alerting or recovering, 1 by default
+	For int
+	// Number of consecutive intervals the threshold has been crossed so far
+	alertPending int
+	// What to do with malformed lines, PolicyCount by default
+	ErrorPolicy ErrorPolicy
+	// File where malformed lines are appended with PolicyQuarantine
+	QuarantineFile string
+	// Number of malformed lines since the last Report
+	ParseErrors int
+	// How the remote hosts are anonymised, AnonymizeNone by default
+	Anonymization Anonymization
+	// Key of the hash of the remote hosts, random by default so that the hashes change at each start
+	HashKey []byte
 	// Number of requests at each update, used for alerting
-	AlertTraffic []int
-	AlertIndex   int
-	// mutex for thread safety
-	Mutex sync.Mutex
+	// The requests are counted in the interval of their date, AlertIntervals gives the interval of each entry
+	AlertTraffic   []int
+	AlertIntervals []int64
+	AlertIndex     int
+	// Time to wait after the end of an interval before closing it, to let delayed lines arrive
+	Lateness time.Duration
+	// Alert rules evaluated at the end of each interval, besides the high traffic alert
+	rules []*ruleState
+	// Counters of the intervals waiting to be closed, by interval number
+	// The interval number of a date is its Unix time divided by UpdateInterval
+	intervals map[int64]*interval
+	// Records parsed by the readers, a nil record is a malformed line to count in ParseErrors
+	// The channel is closed once every reader has stopped
+	lines chan *LogRecord
+	// Maximum time spent handling the last lines and sending the last statistics once the monitor is cancelled
+	ShutdownTimeout time.Duration
+	// abandon is closed when the ShutdownTimeout expires, the pending sends are then abandoned
+	abandon chan struct{}
+	// Changes of the settings sent by Reload to the goroutine owning the monitor
+	reloads chan reload
+	// File where the State of the monitor is saved after each update and when it stops
+	// The monitor resumes from it when it starts, disabled if empty
+	StateFile string
+	// Where the reading of each log file starts, loaded from the StateFile
+	resume map[string]FileState
+	// Position of each log file after the last line reported, it is the one saved to the StateFile
+	positions map[string]FileState
+	// Positions of the lines handled whose interval is still open, by log file in the order of the file
+	pending map[string][]pendingPosition
+	// Alerts currently active, by rule, the high traffic alert has an empty rule
+	active map[string]AlertRecord
+	// flushing is true while the open intervals are closed at shutdown
+	// the intervals from partialFrom had not ended and are reported as partial
+	flushing    bool
+	partialFrom int64
+	// Number of the next interval to close
+	next int64
+	// End of the last closed interval, this is the current time for the alerting
+	windowEnd time.Time
 	// channel to communicate statistics to the display
 	StatChan chan StatRecord
 	// channel to send alerts to the display
 	AlertChan chan AlertRecord
-	// Reopen the file if truncated
+	// Replay the rotated archives of each log file before it, see RotatedFiles
+	Rotated bool
+	// Follow the next file created at the same path once the file is moved or deleted, when it is rotated
 	ReOpenFile bool
+	// Error that stopped the monitor, if any, it may be set by any reader so it is guarded by mutex
+	err   error
+	mutex sync.Mutex
 	// Global app context
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-// New returns a new LogMonitor with the specified parameters
-func New(ctx context.Context, cancel context.CancelFunc, logFile string, statChan chan StatRecord, alertChan chan AlertRecord, timeWindow int, updateInterval int, threshold int, ReOpenFile bool) *LogMonitor {
-	var mutex sync.Mutex
+// New returns a new LogMonitor with the parameters of config, they are checked with Config.Validate
+func New(ctx context.Context, cancel context.CancelFunc, config Config, statChan chan StatRecord, alertChan chan AlertRecord) (*LogMonitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
 	monitor := &LogMonitor{
-		LogFile:        logFile,
-		TimeWindow:     timeWindow,
-		UpdateInterval: updateInterval,
-		InAlert:        false,
-		Threshold:      threshold,
-		LogRecords:     make([]LogRecord, 0),
-		AlertTraffic:   make([]int, timeWindow/updateInterval),
-		AlertIndex:     0,
-		Mutex:          mutex,
-		StatChan:       statChan,
-		AlertChan:      alertChan,
-		ctx:            ctx,
-		cancel:         cancel,
-		ReOpenFile:     ReOpenFile,
-	}
-	return monitor
-}
-
-// ReadLog reads reads the log file
-// continuously  checks for new log lines
+		LogFiles:         config.LogFiles,
+		Parser:           config.Parser,
+		TimeWindow:       config.TimeWindow,
+		UpdateInterval:   config.UpdateInterval,
+		InAlert:          false,
+		Threshold:        config.Threshold,
+		RecoverThreshold: config.RecoverThreshold,
+		For:              config.For,
+		ErrorPolicy:      config.ErrorPolicy,
+		QuarantineFile:   config.QuarantineFile,
+		Anonymization:    config.Anonymization,
+		HashKey:          config.HashKey,
+		AlertTraffic:     make([]int, config.TimeWindow/config.UpdateInterval),
+		AlertIntervals:   make([]int64, config.TimeWindow/config.UpdateInterval),
+		intervals:        make(map[int64]*interval),
+		AlertIndex:       0,
+		lines:            make(chan *LogRecord, linesBuffer),
+		Lateness:         config.Lateness,
+		ShutdownTimeout:  config.ShutdownTimeout,
+		StateFile:        config.StateFile,
+		abandon:          make(chan struct{}),
+		reloads:          make(chan reload),
+		positions:        make(map[string]FileState),
+		pending:          make(map[string][]pendingPosition),
+		active:           make(map[string]AlertRecord),
+		StatChan:         statChan,
+		AlertChan:        alertChan,
+		ctx:              ctx,
+		cancel:           cancel,
+		ReOpenFile:       config.ReOpenFile,
+		Rotated:          config.Rotated,
+	}
+	if len(monitor.HashKey) == 0 {
+		monitor.HashKey = randomKey()
+	}
+	return monitor, nil
+}
+
+// ReadLog reads the log files and the other Sources
+// continuously checks for new log lines, each source is read in its own goroutine
+// The parsed lines are sent to the goroutine owning the monitor, the channel is closed when ReadLog returns
+// The files are read from the position loaded from the StateFile, if any
 func (m *LogMonitor) ReadLog() {
-	// To continuously read the log file, we use the package tail (github.com/hpcloud/tail) that mimicks the fail -f behavior
-	// this package also manages file truncation/rotation which is nice
-	tailListener, err := tail.TailFile(m.LogFile, tail.Config{Follow: true, ReOpen: m.ReOpenFile, MustExist: true, Logger: tail.DiscardingLogger})
+	defer close(m.lines)
+	// Open the quarantine file where malformed lines are kept, it is shared by all files
+	quarantine, err := m.openQuarantine()
 	if err != nil {
-		log.Fatal(err)
+		m.abort(err)
+		return
 	}
-	for {
-		select {
-		case <-m.ctx.Done():
-			return
-		case line := <-tailListener.Lines:
-
-			newRecord, err := ParseLogLine(line.Text)
-			// Thread safety, add new logRecords
-			// Lock to avoid that the monitor flushes the array at the same time when sending statistics
-			// If the log has been correctly parsed, add it to the current record list
-			if err == nil {
-				m.Mutex.Lock()
-				m.LogRecords = append(m.LogRecords, *newRecord)
-				m.Mutex.Unlock()
-			} else {
-				log.Fatal(err)
-			}
+	if quarantine != nil {
+		defer quarantine.Close()
+	}
+	sources := make([]LineSource, 0, len(m.LogFiles)+len(m.Sources))
+	for _, logFile := range m.LogFiles {
+		// Without a saved position, the file is read from its beginning
+		position, ok := m.resume[logFile]
+		if !ok {
+			position, _, _ = currentFile(logFile)
 		}
+		sources = append(sources, NewSource(logFile, position, m.ReOpenFile))
 	}
+	sources = append(sources, m.Sources...)
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source LineSource) {
+			defer wg.Done()
+			m.readSource(source, quarantine)
+		}(source)
+	}
+	wg.Wait()
 }
 
-// Alert sends alerts to the display by sending an AlertRecord to the display through the Alert channel
+// readSource reads the lines of a source until the monitor is cancelled or the source ends
+func (m *LogMonitor) readSource(source LineSource, quarantine *os.File) {
+	err := source.Read(m.ctx, func(line Line) bool {
+		return m.handleLine(source.Name(), line, quarantine)
+	})
+	if err != nil {
+		m.abort(err)
+	}
+}
+
+// handleLine parses a line of a source and sends it to the goroutine owning the monitor
+// It returns false if the reading must stop, because of the ErrorPolicy or the shutdown deadline
+func (m *LogMonitor) handleLine(source string, line Line, quarantine *os.File) bool {
+	newRecord, err := m.Parser.Parse(line.Text)
+	// Only the goroutine owning the monitor updates the counters, the record is sent to it
+	if err == nil {
+		newRecord.source = source
+		newRecord.position = line.Position
+		newRecord.remotehost = AnonymizeHost(newRecord.remotehost, m.Anonymization, m.HashKey)
+		return m.send(newRecord)
+	}
+	counted, err := m.handleParseError(line.Text, err, quarantine)
+	if err != nil {
+		m.abort(err)
+		return false
+	}
+	return !counted || m.send(nil)
+}
+
+// send sends a parsed line to the goroutine owning the monitor
+// The lines read after the cancellation are still sent, it returns false once the shutdown deadline has expired
+func (m *LogMonitor) send(record *LogRecord) bool {
+	select {
+	case m.lines <- record:
+		return true
+	case <-m.abandon:
+		return false
+	}
+}
+
+// abandonAfter closes abandon once timeout has passed since the cancellation of the monitor
+func (m *LogMonitor) abandonAfter(timeout time.Duration) {
+	<-m.ctx.Done()
+	time.Sleep(timeout)
+	close(m.abandon)
+}
+
+// handle updates the monitor with a line sent by a reader
+func (m *LogMonitor) handle(record *LogRecord) {
+	if record == nil {
+		m.ParseErrors++
+		return
+	}
+	now := time.Now()
+	n := m.intervalOf(record.date)
+	if m.future(record.date, now) {
+		n = m.intervalOf(now)
+	}
+	m.addTo(n, record)
+	// Only the files have a position to save
+	if record.position.Offset > 0 {
+		// A late record is counted in the next interval to close
+		if n < m.next {
+			n = m.next
+		}
+		m.track(record.source, n, record.position)
+	}
+}
+
+// pendingPosition is the position after the last line of a run of lines of the same interval
+type pendingPosition struct {
+	interval int64
+	position FileState
+}
+
+// track records the position after a line of logFile counted in interval n
+// The position is saved once the interval and every interval of the previous lines are closed
+func (m *LogMonitor) track(logFile string, n int64, position FileState) {
+	runs := m.pending[logFile]
+	if last := len(runs) - 1; last >= 0 && runs[last].interval == n {
+		runs[last].position = position
+		return
+	}
+	m.pending[logFile] = append(runs, pendingPosition{interval: n, position: position})
+}
+
+// checkpoint moves the position of each log file after its lines reported once interval n is closed
+// It stops at the first line of an interval still open, so a restart never skips a line that was not reported
+func (m *LogMonitor) checkpoint(n int64) {
+	for logFile, runs := range m.pending {
+		i := 0
+		for ; i < len(runs) && runs[i].interval <= n; i++ {
+			m.positions[logFile] = runs[i].position
+		}
+		if i == len(runs) {
+			delete(m.pending, logFile)
+		} else {
+			m.pending[logFile] = runs[i:]
+		}
+	}
+}
+
+// openQuarantine opens the file where malformed lines are kept with PolicyQuarantine
+// It returns a nil file with the other policies
+func (m *LogMonitor) openQuarantine() (*os.File, error) {
+	if m.ErrorPolicy != PolicyQuarantine {
+		return nil, nil
+	}
+	return os.OpenFile(m.QuarantineFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+}
+
+// handleParseError applies the ErrorPolicy to a line that could not be parsed
+// It returns true if the line must be counted in ParseErrors, and an error only if the monitor has to stop
+func (m *LogMonitor) handleParseError(line string, parseErr error, quarantine *os.File) (bool, error) {
+	switch m.ErrorPolicy {
+	case PolicySkip:
+		return false, nil
+	case PolicyAbort:
+		return false, fmt.Errorf("%v: %q", parseErr, line)
+	case PolicyQuarantine:
+		if _, err := quarantine.WriteString(line + "\n"); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// abort stops the whole app because of err
+// log.Fatal is not used as the display may still own the terminal, the error is returned by Err instead
+func (m *LogMonitor) abort(err error) {
+	m.mutex.Lock()
+	m.err = err
+	m.mutex.Unlock()
+	m.cancel()
+}
+
+// Err returns the error that stopped the monitor, nil if it was stopped normally
+func (m *LogMonitor) Err() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.err
+}
+
+// Alert sends the high traffic alerts to the display by sending an AlertRecord to the display through the Alert channel
 func (m *LogMonitor) Alert() {
+	numTraffic := m.windowTraffic()
+	// If the number of requests is above threshold*timeWindow for long enough and the monitor was not in Alert
+	// set InAlert to true and send an AlertRecord to the display
+	// If the number of requests is below recoverThreshold*timeWindow for long enough and the monitor was in Alert
+	// set InAlert to false and send an AlertRecord to the display
+	above := numTraffic > m.Threshold*m.TimeWindow
+	below := numTraffic < m.RecoverThreshold*m.TimeWindow
+	if !stateChange(m.InAlert, above, below, &m.alertPending, m.For) {
+		return
+	}
+	m.InAlert = !m.InAlert
+	m.sendAlert(AlertRecord{
+		Alert:      m.InAlert,
+		NumTraffic: numTraffic,
+		Time:       m.windowEnd,
+	})
+}
+
+// sendAlert sends an AlertRecord to the display, unless the shutdown deadline has expired
+func (m *LogMonitor) sendAlert(alert AlertRecord) {
+	switch {
+	case alert.Reload != "":
+		// A reload is not an alert
+	case alert.Alert:
+		m.active[alert.Rule] = alert
+	default:
+		delete(m.active, alert.Rule)
+	}
+	select {
+	case m.AlertChan <- alert:
+	case <-m.abandon:
+	}
+}
+
+// stateChange tells whether an alert changes its state at this evaluation
+// above is true if the metric is above the alerting threshold, below if it is below the recovery threshold
+// The state changes once the condition has held for forIntervals consecutive evaluations,
+// pending counts these evaluations and is reset whenever the condition does not hold
+func stateChange(inAlert bool, above bool, below bool, pending *int, forIntervals int) bool {
+	if inAlert && !below || !inAlert && !above {
+		*pending = 0
+		return false
+	}
+	*pending++
+	if *pending < forIntervals {
+		return false
+	}
+	*pending = 0
+	return true
+}
+
+// interval holds the counters of the records whose date falls in the same UpdateInterval
+type interval struct {
+	stats *Aggregate
+	// counters of each log file, only kept when several files are monitored
+	sources map[string]*Aggregate
+	// number of records belonging to an already closed interval, they are reported with this one
+	late int
+}
+
+// add updates the counters of the interval with a record
+func (in *interval) add(record *LogRecord) {
+	in.stats.Add(record)
+	if in.sources != nil {
+		if in.sources[record.source] == nil {
+			in.sources[record.source] = NewAggregate()
+		}
+		in.sources[record.source].Add(record)
+	}
+}
+
+// intervalOf returns the number of the interval containing date
+func (m *LogMonitor) intervalOf(date time.Time) int64 {
+	return date.Unix() / int64(m.UpdateInterval)
+}
+
+// intervalStart returns the start time of interval n
+func (m *LogMonitor) intervalStart(n int64) time.Time {
+	return time.Unix(n*int64(m.UpdateInterval), 0)
+}
+
+// Start sets the first interval to report, the one containing now
+func (m *LogMonitor) Start(now time.Time) {
+	m.next = m.intervalOf(now)
+}
+
+// future tells whether a date is more than an UpdateInterval after now, the clock that wrote it is wrong
+// Such a record is counted in the interval containing now instead of opening an interval far in the future,
+// every interval before it would have to be closed to report it
+func (m *LogMonitor) future(date time.Time, now time.Time) bool {
+	return date.After(now.Add(time.Duration(m.UpdateInterval) * time.Second))
+}
+
+// add counts a record in the interval of its date
+func (m *LogMonitor) add(record *LogRecord) {
+	m.addTo(m.intervalOf(record.date), record)
+}
+
+// addTo counts a record in interval n
+// A record whose interval has already been closed still counts in the alerting window if it is not too old,
+// its statistics are reported with the next interval
+func (m *LogMonitor) addTo(n int64, record *LogRecord) {
+	if n >= m.next {
+		m.bucket(n).add(record)
+		return
+	}
+	// Late record, add it to the traffic of its interval if it is still in the window
+	idx := int(n % int64(len(m.AlertTraffic)))
+	if m.AlertIntervals[idx] == n {
+		m.AlertTraffic[idx]++
+	}
+	current := m.bucket(m.next)
+	current.add(record)
+	current.late++
+}
+
+// bucket returns interval n, creating it if needed
+func (m *LogMonitor) bucket(n int64) *interval {
+	if m.intervals[n] == nil {
+		m.intervals[n] = &interval{stats: NewAggregate()}
+		if names := m.sourceNames(); len(names) > 1 {
+			m.intervals[n].sources = make(map[string]*Aggregate, len(names))
+		}
+	}
+	return m.intervals[n]
+}
+
+// CloseIntervals closes every interval ending before until, in chronological order
+// Each closed interval updates the alerting window, checks for alerts and reports its statistics
+func (m *LogMonitor) CloseIntervals(until time.Time) {
+	for !m.intervalStart(m.next + 1).After(until) {
+		m.closeInterval(m.next)
+		m.next++
+	}
+}
+
+// closeInterval adds the traffic of interval n to the alerting window, then alerts and reports
+func (m *LogMonitor) closeInterval(n int64) {
+	current := m.bucket(n)
+	delete(m.intervals, n)
+
+	// add the traffic number to the AlertTraffic array
+	// The interval may already be there if the monitor stopped during it and resumed from the StateFile
+	m.AlertIndex = int(n % int64(len(m.AlertTraffic)))
+	if m.AlertIntervals[m.AlertIndex] != n {
+		m.AlertTraffic[m.AlertIndex] = 0
+	}
+	m.AlertTraffic[m.AlertIndex] += current.stats.Requests() - current.late
+	m.AlertIntervals[m.AlertIndex] = n
+	m.AlertIndex = (m.AlertIndex + 1) % len(m.AlertTraffic)
+	m.windowEnd = m.intervalStart(n + 1)
+
+	m.Alert()
+	m.evaluateRules(current.stats)
+	m.Report(current.stats, current.sources, m.intervalStart(n))
+	m.checkpoint(n)
+}
+
+// windowTraffic sums up the traffic in the time window
+func (m *LogMonitor) windowTraffic() int {
 	numTraffic := 0
-	// sum up the traffic in the time window
 	for _, t := range m.AlertTraffic {
 		numTraffic += t
 	}
-	// If the number of requests is above threshold*timeWindow and the monitor was not in Alert
-	// set InAlert to true and send an AlertRecord to the display
-	if numTraffic > m.Threshold*m.TimeWindow && !m.InAlert {
-		m.InAlert = true
-		m.AlertChan <- AlertRecord{
-			Alert:      true,
-			NumTraffic: numTraffic,
+	return numTraffic
+}
+
+// sourceNames returns the names of the log files and of the other sources
+func (m *LogMonitor) sourceNames() []string {
+	if len(m.Sources) == 0 {
+		return m.LogFiles
+	}
+	names := append([]string(nil), m.LogFiles...)
+	for _, source := range m.Sources {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+// ExpandFiles expands the glob patterns of a list of log files
+// Every pattern must match at least one file, the result has no duplicate
+func ExpandFiles(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		// The standard input is not a file
+		if pattern == StdinName {
+			if !seen[pattern] {
+				seen[pattern] = true
+				files = append(files, pattern)
+			}
+			continue
 		}
-		// If the number of requests is below threshold*timeWindow and the monitor was in in Alert
-		// set InAlert to false and send an AlertRecord to the display
-	} else if numTraffic < m.Threshold*m.TimeWindow && m.InAlert {
-		m.InAlert = false
-		m.AlertChan <- AlertRecord{
-			Alert:      false,
-			NumTraffic: numTraffic,
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("file %s does not exist.", pattern)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
 		}
 	}
+	return files, nil
 }
 
-// Report sends log statistics to the display
-func (m *LogMonitor) Report() {
-	// Compute the stats of the current records
-	m.Mutex.Lock()
-	statRecord := GetStats(m.LogRecords, 5)
+// Report sends the statistics of the interval starting at start to the display
+// sources holds the counters of each file, it is only used when several files are monitored
+func (m *LogMonitor) Report(stats *Aggregate, sources map[string]*Aggregate, start time.Time) {
+	// Snapshot the counters of the interval
+	statRecord := stats.Stats(5)
+	statRecord.Time = start
+	statRecord.WindowTraffic = m.windowTraffic()
+	// Break the statistics down by file if there are several of them
+	if names := m.sourceNames(); len(names) > 1 {
+		statRecord.Sources = make(map[string]StatRecord, len(names))
+		for _, logFile := range names {
+			source := sources[logFile]
+			if source == nil {
+				source = NewAggregate()
+			}
+			sourceRecord := source.Stats(5)
+			sourceRecord.Time = start
+			statRecord.Sources[logFile] = sourceRecord
+		}
+	}
 
-	// Thread safety, add new logRecords
-	// Lock to avoid that the monitor adds new records at the same time it is flushing
-	m.LogRecords = nil
-	m.Mutex.Unlock()
-	// Send stats using the StatChan
-	m.StatChan <- statRecord
+	statRecord.ParseErrors = m.ParseErrors
+	m.ParseErrors = 0
+	statRecord.Partial = m.flushing && m.intervalOf(start) >= m.partialFrom
+	// Send stats using the StatChan, unless the shutdown deadline has expired
+	select {
+	case m.StatChan <- statRecord:
+	case <-m.abandon:
+	}
 }
 
 // Run is the main function of the monitor
+// Once the monitor is cancelled, it handles the lines still being read, reports the open intervals
+// and closes StatChan and AlertChan, all within the ShutdownTimeout
 func (m *LogMonitor) Run() {
+	go m.abandonAfter(m.ShutdownTimeout)
+	m.Start(time.Now())
+	if err := m.loadState(); err != nil {
+		m.abort(err)
+	}
 	// Concurrently read the log file
 	go m.ReadLog()
-	// Do the alerting and send the statistics each UpdateInterval seconds with a ticker
+	// Do the alerting and send the statistics of the intervals that ended with a ticker
+	// This goroutine is the only one updating the state of the monitor
 	ticker := time.NewTicker(time.Second * time.Duration(m.UpdateInterval))
+	defer func() { ticker.Stop() }()
+	lines := m.lines
 	for {
 		select {
-		case <-ticker.C:
-			// add the traffic number to the AlertTraffic array
-			m.AlertTraffic[m.AlertIndex] = len(m.LogRecords)
-			m.AlertIndex += 1
-			m.AlertIndex = m.AlertIndex % (m.TimeWindow / m.UpdateInterval)
-			m.Alert()
-			m.Report()
+		case record, ok := <-lines:
+			if !ok {
+				// Every reader stopped, keep reporting until the monitor is cancelled
+				lines = nil
+				continue
+			}
+			m.handle(record)
+		case now := <-ticker.C:
+			m.CloseIntervals(now.Add(-m.Lateness))
+			m.saveState()
+		case r := <-m.reloads:
+			previousInterval := m.UpdateInterval
+			m.applyReload(r, time.Now())
+			m.saveState()
+			// The ticker follows the new update interval
+			if m.UpdateInterval != previousInterval {
+				ticker.Stop()
+				ticker = time.NewTicker(time.Second * time.Duration(m.UpdateInterval))
+			}
 		case <-m.ctx.Done():
+			m.shutdown(lines)
 			return
 		}
 	}
 }
+
+// shutdown handles the last lines sent by the readers until they stop, then reports the open intervals
+// The current interval is reported as partial, the state of the monitor is saved once every line handled is reported
+func (m *LogMonitor) shutdown(lines chan *LogRecord) {
+	defer close(m.StatChan)
+	defer close(m.AlertChan)
+	for lines != nil {
+		select {
+		case record, ok := <-lines:
+			if !ok {
+				lines = nil
+				continue
+			}
+			m.handle(record)
+		case <-m.abandon:
+			lines = nil
+		}
+	}
+	m.flush(time.Now())
+	m.saveState()
+}
+
+// flush closes every open interval, the ones that had not ended at now are reported as partial
+// The intervals are closed one by one up to the one containing now, the ones after it only if they have records
+func (m *LogMonitor) flush(now time.Time) {
+	m.flushing = true
+	m.partialFrom = m.intervalOf(now)
+	m.CloseIntervals(m.intervalStart(m.partialFrom + 1))
+	// Only the records dated slightly after now are left, see future
+	later := make([]int64, 0, len(m.intervals))
+	for n := range m.intervals {
+		later = append(later, n)
+	}
+	sort.Slice(later, func(i, j int) bool { return later[i] < later[j] })
+	for _, n := range later {
+		m.closeInterval(n)
+		m.next = n + 1
+	}
+}
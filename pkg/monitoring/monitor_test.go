@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/Baumanar/log-monitor/pkg/generator"
+	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -39,7 +41,7 @@ func TestLogMonitor_readLog(t *testing.T) {
 			// Create a new monitor
 			statChan := make(chan StatRecord)
 			alertChan := make(chan AlertRecord)
-			monitor := New(ctx, cancel, "test"+strconv.Itoa(idx)+".log", statChan, alertChan, 10, 5, 10, false)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test" + strconv.Itoa(idx) + ".log"}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
 
 			go func() {
 				// Let a short time for the monitor to get at the end of the file
@@ -55,10 +57,10 @@ func TestLogMonitor_readLog(t *testing.T) {
 			}()
 
 			// Check for new lines
-			monitor.ReadLog()
+			readAll(monitor)
 
-			if len(monitor.LogRecords) != tt.want {
-				t.Errorf("ReadLog() \nread = %v lines \nwant %v lines", len(monitor.LogRecords), tt.want)
+			if read, _ := pendingRequests(monitor); read != tt.want {
+				t.Errorf("ReadLog() \nread = %v lines \nwant %v lines", read, tt.want)
 			}
 			err = os.Remove("test" + strconv.Itoa(idx) + ".log")
 			if err != nil {
@@ -81,7 +83,7 @@ func TestLogMonitor_readLog1(t *testing.T) {
 		// Create a new monitor
 		statChan := make(chan StatRecord)
 		alertChan := make(chan AlertRecord)
-		monitor := New(ctx, cancel, "test.log", statChan, alertChan, 10, 5, 10, false)
+		monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
 		// Wait for 1 second before cancelling
 		go func() {
 			time.Sleep(time.Second * 1)
@@ -148,12 +150,13 @@ func TestLogMonitor_alert(t *testing.T) {
 
 	// Run tests
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a new monitor
 			statChan := make(chan StatRecord)
 			alertChan := make(chan AlertRecord)
-			monitor := New(ctx, cancel, "test.log", statChan, alertChan, tt.timeWindow, 5, tt.threshold, false)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: tt.timeWindow, UpdateInterval: 5, Threshold: tt.threshold}, statChan, alertChan)
 			// Init the Alert state
 			monitor.InAlert = tt.startState
 			go func() {
@@ -186,6 +189,7 @@ func TestLogMonitor_alert(t *testing.T) {
 }
 
 func TestLogMonitor_report(t *testing.T) {
+	date := time.Date(2020, 3, 27, 12, 16, 30, 0, time.UTC)
 
 	tests := []struct {
 		name       string
@@ -194,39 +198,63 @@ func TestLogMonitor_report(t *testing.T) {
 	}{
 		{"test0",
 			[]LogRecord{
-				{"a", "a", "a", "a", "a", "a", "a", "a", 2000},
-				{"a", "a", "a", "a", "a", "a", "a", "a", 2000},
-				{"a", "a", "a", "a", "a", "a", "a", "a", 5000},
-				{"b", "b", "b", "b", "b", "b", "b", "b", 10000}},
-
-			StatRecord{[]Pair{{"a", 3}, {"b", 1}},
-				[]Pair{{"a", 3}, {"b", 1}},
-				[]Pair{{"a", 3}, {"b", 1}},
-				4,
-				"19.0 kB"},
+				{remotehost: "a", rfc931: "a", authuser: "a", date: date, method: "a", section: "a", status: "a", protocol: "a", bytesCount: 2000},
+				{remotehost: "a", rfc931: "a", authuser: "a", date: date, method: "a", section: "a", status: "a", protocol: "a", bytesCount: 2000},
+				{remotehost: "a", rfc931: "a", authuser: "a", date: date, method: "a", section: "a", status: "a", protocol: "a", bytesCount: 5000},
+				{remotehost: "b", rfc931: "b", authuser: "b", date: date, method: "b", section: "b", status: "b", protocol: "b", bytesCount: 10000}},
+
+			StatRecord{
+				Time:        date,
+				TopSections: []Pair{{"a", 3}, {"b", 1}},
+				TopMethods:  []Pair{{"a", 3}, {"b", 1}},
+				TopStatus:   []Pair{{"a", 3}, {"b", 1}},
+				TopHosts:    []Pair{{"a", 3}, {"b", 1}},
+				TopUsers:    []Pair{{"a", 3}, {"b", 1}},
+				NumRequests: 4,
+				BytesCount:  "19.0 kB",
+				Sections:    map[string]int{"a": 3, "b": 1},
+				Methods:     map[string]int{"a": 3, "b": 1},
+				Status:      map[string]int{"a": 3, "b": 1},
+				NumBytes:    19000},
+		},
+		// Unauthenticated requests are not counted in the top users
+		{"test1",
+			[]LogRecord{
+				{remotehost: "10.0.0.1", rfc931: "-", authuser: "-", date: date, method: "GET", section: "/", status: "200", protocol: "HTTP/1.1"},
+				{remotehost: "10.0.0.1", rfc931: "-", authuser: "jill", date: date, method: "GET", section: "/", status: "200", protocol: "HTTP/1.1"}},
+
+			StatRecord{
+				Time:        date,
+				TopSections: []Pair{{"/", 2}},
+				TopMethods:  []Pair{{"GET", 2}},
+				TopStatus:   []Pair{{"2xx", 2}},
+				TopHosts:    []Pair{{"10.0.0.1", 2}},
+				TopUsers:    []Pair{{"jill", 1}},
+				NumRequests: 2,
+				BytesCount:  "0 B",
+				Sections:    map[string]int{"/": 2},
+				Methods:     map[string]int{"GET": 2},
+				Status:      map[string]int{"2xx": 2},
+				NumBytes:    0},
 		},
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	for _, tt := range tests {
 
 		t.Run(tt.name, func(t *testing.T) {
 			statChan := make(chan StatRecord)
 			alertChan := make(chan AlertRecord)
-			monitor := New(ctx, cancel, "test.log", statChan, alertChan, 120, 5, 10, false)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 120, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
 			go func() {
-				monitor.LogRecords = tt.logRecords
-				monitor.Report()
+				monitor.Report(aggregateOf(tt.logRecords), nil, date)
 			}()
 			got := <-monitor.StatChan
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Report() \ngot = %v \nwant %v", got, tt.want)
 			}
-			if monitor.LogRecords != nil {
-				t.Errorf("LogRecords is not empty")
-
-			}
 		})
 	}
 }
@@ -250,7 +278,7 @@ func TestLogMonitor_Run(t *testing.T) {
 			statChan := make(chan StatRecord, 3)
 			alertChan := make(chan AlertRecord, 3)
 			// Set the alertFreq to 1 second so the function still sends some info the the statChan
-			monitor := New(ctx, cancel, "test.log", statChan, alertChan, 120, 1, 10, false)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 120, UpdateInterval: 1, Threshold: 10}, statChan, alertChan)
 
 			// call cancel after 2 seconds
 			go func() {
@@ -287,21 +315,23 @@ func TestLogMonitor_Run1(t *testing.T) {
 			statChan := make(chan StatRecord)
 			alertChan := make(chan AlertRecord)
 			// The size of the alertTraffic should be maximum 3 and be updated every second
-			monitor := New(ctx, cancel, "test.log", statChan, alertChan, 3, 1, 10, false)
-			monitor.LogRecords = []LogRecord{}
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 3, UpdateInterval: 1, Threshold: 10}, statChan, alertChan)
 			go func() {
 				// Let the monitor run for 5 seconds
 				ticker := time.NewTicker(time.Second * time.Duration(6))
-				// counter ton compare the size of AlertTraffic a each tick
-				counter := 1
+				// The intervals are closed one by one, the time of each statistic is one second after the previous one
+				var previous time.Time
 				for {
 					select {
-					case <-monitor.StatChan:
-						//fmt.Println(counter % 3, monitor.AlertIndex)
-						if counter%3 != monitor.AlertIndex {
-							t.Errorf("monitor.LogRecords should be maximum %d: got: %d", Min(counter, 3), len(monitor.AlertTraffic))
+					case stat, ok := <-monitor.StatChan:
+						// The channel is closed once the monitor has stopped
+						if !ok {
+							return
 						}
-						counter++
+						if !previous.IsZero() && !stat.Time.Equal(previous.Add(time.Second)) {
+							t.Errorf("stat.Time should be %v: got: %v", previous.Add(time.Second), stat.Time)
+						}
+						previous = stat.Time
 
 					case <-ticker.C:
 						cancel()
@@ -310,6 +340,10 @@ func TestLogMonitor_Run1(t *testing.T) {
 			}()
 			// Start log generation, if should be stopped after 1s
 			monitor.Run()
+			// The monitor never writes the window after New, it cannot grow
+			if len(monitor.AlertTraffic) != 3 {
+				t.Errorf("monitor.AlertTraffic should be of size 3: got: %d", len(monitor.AlertTraffic))
+			}
 		})
 	}
 	err := os.Remove("test.log")
@@ -327,69 +361,438 @@ func TestLogMonitor_Run2(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := os.Create("race.log")
+			// A file of its own, the tailers of the previous runs are still watching theirs
+			file, err := ioutil.TempFile("", "race*.log")
 			if err != nil {
-				log.Fatal(err)
+				t.Fatal(err)
 			}
+			file.Close()
+			defer os.Remove(file.Name())
 
 			ctx, cancel := context.WithCancel(context.Background())
 			// Make buffered channels of size 3 so they are not blocking, we won't use them here
 			statChan := make(chan StatRecord)
 			alertChan := make(chan AlertRecord)
 			// Set the alertFreq to 1 second so the function still sends some info the the statChan
-			monitor := New(ctx, cancel, "race.log", statChan, alertChan, 120, 1, 1000000, false)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{file.Name()}, TimeWindow: 120, UpdateInterval: 1, Threshold: 1000000}, statChan, alertChan)
 
-			count := 0
+			// The writer sends the number of lines it wrote, the reader sends the final counts once it is done
+			total := make(chan int, 1)
+			written := make(chan int, 1)
+			read := make(chan int, 1)
 			go func() {
-				//stop writing logs after 10 seconds
-				tickerWrite := time.NewTicker(time.Duration(10) * time.Second)
-
+				count := 0
 				time.Sleep(500 * time.Millisecond)
 				step := 2000
-				for {
-					select {
-					case <-tickerWrite.C:
-						return
-					default:
-						for i := 0; i < step; i++ {
-							generator.WriteLogLine("race.log")
-						}
-						count += step
-						time.Sleep(50 * time.Millisecond)
-						//fmt.Printf("generator wrote %d lines\n", count)
+				for i := 0; i < 20; i++ {
+					for j := 0; j < step; j++ {
+						generator.WriteLogLine(file.Name())
 					}
+					count += step
+					time.Sleep(50 * time.Millisecond)
 				}
+				total <- count
 			}()
-			// Start log generation, if should be stopped after 1s
-			countRead := 0
+			// The monitor is stopped once every line written has been reported, the deadline only ends a failing test
 			go func() {
-				//stop reading logs after 12 seconds
-				tickerRead := time.NewTicker(time.Duration(12) * time.Second)
-				for {
-
+				count, countRead := -1, 0
+				deadline := time.NewTimer(time.Minute)
+				defer deadline.Stop()
+			loop:
+				for count < 0 || countRead < count {
 					select {
+					case count = <-total:
 					case stat := <-statChan:
-						// add the traffic number to the AlertTraffic array
 						countRead += stat.NumRequests
-						fmt.Printf("monitor read %d lines\n", countRead)
 					case alert := <-alertChan:
-						// add the traffic number to the AlertTraffic array
 						fmt.Printf("Alert:  %d \n", alert.NumTraffic)
-					case <-tickerRead.C:
-						// Cancel to stop the monitor running in the main process
-						cancel()
+					case <-deadline.C:
+						break loop
+					}
+				}
+				// The open intervals are flushed when the monitor stops, then the channels are closed
+				cancel()
+				for statChan != nil || alertChan != nil {
+					select {
+					case stat, ok := <-statChan:
+						if !ok {
+							statChan = nil
+							continue
+						}
+						countRead += stat.NumRequests
+					case _, ok := <-alertChan:
+						if !ok {
+							alertChan = nil
+						}
 					}
 				}
+				written <- count
+				read <- countRead
 			}()
 			monitor.Run()
+			count, countRead := <-written, <-read
 			fmt.Printf("Final written: %d \n Final read: %d \n", count, countRead)
 			if countRead != count {
 				t.Errorf("Final written: %d \n Final read: %d \n", count, countRead)
 			}
 		})
 	}
-	err := os.Remove("race.log")
-	if err != nil {
-		log.Fatal(err)
+}
+
+// Checks that malformed lines are handled according to the ErrorPolicy of the monitor
+func TestLogMonitor_readLogErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          ErrorPolicy
+		wantRecords     int
+		wantParseErrors int
+		wantQuarantine  int
+		wantErr         bool
+	}{
+		{"skip", PolicySkip, 20, 0, 0, false},
+		{"count", PolicyCount, 20, 3, 0, false},
+		{"quarantine", PolicyQuarantine, 20, 3, 3, false},
+		{"abort", PolicyAbort, 10, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			// Each test has its own file as the tail of the previous test is still running
+			logFile := "policy_" + tt.name + ".log"
+			_, err := os.Create(logFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.Remove(logFile)
+			defer os.Remove(logFile + ".quarantine")
+
+			statChan := make(chan StatRecord)
+			alertChan := make(chan AlertRecord)
+			monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{logFile}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
+			monitor.ErrorPolicy = tt.policy
+			monitor.QuarantineFile = logFile + ".quarantine"
+
+			written := make(chan bool)
+			go func() {
+				defer close(written)
+				time.Sleep(100 * time.Millisecond)
+				for i := 0; i < 10; i++ {
+					generator.WriteLogLine(logFile)
+				}
+				f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0600)
+				if err != nil {
+					log.Fatal(err)
+				}
+				f.WriteString("truncated line\nGET /health\n\n")
+				f.Close()
+				for i := 0; i < 10; i++ {
+					generator.WriteLogLine(logFile)
+				}
+				time.Sleep(200 * time.Millisecond)
+				cancel()
+			}()
+			readAll(monitor)
+			// With PolicyAbort the reading stops before the end of the writing
+			<-written
+
+			if read, _ := pendingRequests(monitor); read != tt.wantRecords {
+				t.Errorf("ReadLog() read %d records, want %d", read, tt.wantRecords)
+			}
+			if monitor.ParseErrors != tt.wantParseErrors {
+				t.Errorf("ReadLog() counted %d parse errors, want %d", monitor.ParseErrors, tt.wantParseErrors)
+			}
+			if (monitor.Err() != nil) != tt.wantErr {
+				t.Errorf("Err() = %v, wantErr %v", monitor.Err(), tt.wantErr)
+			}
+			quarantined, _ := ioutil.ReadFile(logFile + ".quarantine")
+			if lines := strings.Count(string(quarantined), "\n"); lines != tt.wantQuarantine {
+				t.Errorf("quarantine file has %d lines, want %d", lines, tt.wantQuarantine)
+			}
+		})
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	if got, err := ParseErrorPolicy("quarantine"); err != nil || got != PolicyQuarantine {
+		t.Errorf("ParseErrorPolicy() = %v, %v", got, err)
+	}
+	if _, err := ParseErrorPolicy("ignore"); err == nil {
+		t.Errorf("ParseErrorPolicy() should fail on an unknown policy")
+	}
+}
+
+// Checks that records are reported in the interval of their date whatever their arrival order
+func TestLogMonitor_closeIntervals(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	// intervals of 10s and alerting window of 30s, alert above 1 request per second
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, statChan, alertChan)
+
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) LogRecord {
+		return LogRecord{date: start.Add(time.Duration(seconds) * time.Second), section: "/a", method: "GET", status: "200"}
+	}
+	monitor.Start(start)
+
+	// Records of the first and second intervals arrive in the wrong order
+	for _, record := range []LogRecord{at(12), at(3), at(15), at(5), at(9)} {
+		monitor.add(&record)
+	}
+	monitor.CloseIntervals(start.Add(10 * time.Second))
+	if stat := <-statChan; stat.NumRequests != 3 || !stat.Time.Equal(start) {
+		t.Errorf("first interval: got %d requests at %v, want 3 at %v", stat.NumRequests, stat.Time, start)
+	}
+
+	// A late record of the first interval arrives after it has been closed
+	// it is reported with the second interval but counted in the traffic of the first one
+	for i := 0; i < 30; i++ {
+		record := at(1)
+		monitor.add(&record)
+	}
+	monitor.CloseIntervals(start.Add(25 * time.Second))
+	if stat := <-statChan; stat.NumRequests != 32 || !stat.Time.Equal(start.Add(10*time.Second)) {
+		t.Errorf("second interval: got %d requests at %v, want 32", stat.NumRequests, stat.Time)
+	}
+	select {
+	case alert := <-alertChan:
+		// 3+30 requests in the first interval and 2 in the second one
+		want := AlertRecord{Alert: true, NumTraffic: 35, Time: start.Add(20 * time.Second)}
+		if !alert.Time.Equal(want.Time) || alert.NumTraffic != want.NumTraffic || !alert.Alert {
+			t.Errorf("got alert %v, want %v", alert, want)
+		}
+	default:
+		t.Errorf("the late records should have triggered an alert")
+	}
+
+	// The intervals without records are reported too
+	monitor.CloseIntervals(start.Add(50 * time.Second))
+	for i := 0; i < 3; i++ {
+		if stat := <-statChan; stat.NumRequests != 0 {
+			t.Errorf("empty interval: got %d requests", stat.NumRequests)
+		}
+	}
+	// The first interval is out of the window, the alert recovered at the end of the fourth interval
+	if alert := <-alertChan; alert.Alert || !alert.Time.Equal(start.Add(40*time.Second)) {
+		t.Errorf("got alert %v, want a recovery at %v", alert, start.Add(40*time.Second))
+	}
+}
+
+// Checks that the open intervals are reported when the monitor stops, the current one as partial
+func TestLogMonitor_flush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, statChan, alertChan)
+
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	monitor.Start(start)
+	for _, seconds := range []int{2, 14, 15} {
+		record := LogRecord{date: start.Add(time.Duration(seconds) * time.Second), section: "/a", method: "GET", status: "200"}
+		monitor.add(&record)
+	}
+	// The monitor stops during the second interval
+	monitor.flush(start.Add(17 * time.Second))
+	close(statChan)
+
+	tests := []struct {
+		name        string
+		numRequests int
+		partial     bool
+	}{
+		{"test0", 1, false},
+		{"test1", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, ok := <-statChan
+			if !ok {
+				t.Fatalf("flush() should report the interval")
+			}
+			if stat.NumRequests != tt.numRequests || stat.Partial != tt.partial {
+				t.Errorf("flush() got %d requests, partial %v, want %d, %v", stat.NumRequests, stat.Partial, tt.numRequests, tt.partial)
+			}
+		})
+	}
+	if stat, ok := <-statChan; ok {
+		t.Errorf("flush() reported an interval after the current one: %v", stat)
+	}
+}
+
+// Checks that a record dated far in the future is counted in the current interval and that flush stops at now
+func TestLogMonitor_future(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, statChan, alertChan)
+
+	now := time.Now()
+	monitor.Start(now)
+	tests := []struct {
+		name string
+		date time.Time
+		want int64
+	}{
+		{"test0", now, monitor.intervalOf(now)},
+		{"test1", now.Add(5 * time.Second), monitor.intervalOf(now.Add(5 * time.Second))},
+		{"test2", now.Add(time.Hour), monitor.intervalOf(now)},
+		{"test3", time.Date(2099, 3, 27, 12, 0, 0, 0, time.UTC), monitor.intervalOf(now)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := LogRecord{date: tt.date, section: "/a", method: "GET", status: "200"}
+			monitor.handle(&record)
+			if monitor.intervals[tt.want] == nil {
+				t.Errorf("handle() should count the record in interval %d, intervals: %v", tt.want, monitor.intervals)
+			}
+		})
+	}
+	if len(monitor.intervals) > 2 {
+		t.Errorf("handle() opened %d intervals, want at most 2", len(monitor.intervals))
+	}
+
+	// A record added without the check, flush reports it without closing every interval before it
+	record := LogRecord{date: time.Date(2099, 3, 27, 12, 0, 0, 0, time.UTC), section: "/a", method: "GET", status: "200"}
+	monitor.add(&record)
+	monitor.flush(now)
+	close(statChan)
+	requests := 0
+	for stat := range statChan {
+		requests += stat.NumRequests
+	}
+	if requests != 5 || len(monitor.intervals) != 0 {
+		t.Errorf("flush() reported %d requests, want 5, open intervals: %d", requests, len(monitor.intervals))
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	for _, name := range []string{"expand_a.log", "expand_b.log"} {
+		if _, err := os.Create(name); err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(name)
+	}
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{"test0", []string{"expand_*.log"}, []string{"expand_a.log", "expand_b.log"}, false},
+		{"test1", []string{"expand_b.log", "expand_*.log"}, []string{"expand_b.log", "expand_a.log"}, false},
+		{"test2", []string{"expand_a.log", "missing.log"}, nil, true},
+		{"test3", []string{"expand_[.log"}, nil, true},
+		{"test4", []string{"-", "expand_a.log", "-"}, []string{"-", "expand_a.log"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandFiles(tt.patterns)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandFiles() = %v, want %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExpandFiles() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Checks that several files are read concurrently and that each record knows its file
+func TestLogMonitor_readLogFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	files := []string{"multi_a.log", "multi_b.log"}
+	for _, name := range files {
+		if _, err := os.Create(name); err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(name)
+	}
+	statChan := make(chan StatRecord)
+	alertChan := make(chan AlertRecord)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: files, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		for i := 0; i < 30; i++ {
+			generator.WriteLogLine(files[0])
+		}
+		for i := 0; i < 12; i++ {
+			generator.WriteLogLine(files[1])
+		}
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	readAll(monitor)
+
+	_, counts := pendingRequests(monitor)
+	if counts[files[0]] != 30 || counts[files[1]] != 12 {
+		t.Errorf("ReadLog() read %v, want 30 and 12 lines", counts)
+	}
+}
+
+// readAll reads the log files like Run, until the monitor is cancelled
+func readAll(m *LogMonitor) {
+	go m.ReadLog()
+	for record := range m.lines {
+		m.handle(record)
+	}
+}
+
+// pendingRequests returns the number of requests of the intervals not closed yet, in total and by file
+func pendingRequests(m *LogMonitor) (int, map[string]int) {
+	total, bySource := 0, make(map[string]int)
+	for _, in := range m.intervals {
+		total += in.stats.Requests()
+		for source, stats := range in.sources {
+			bySource[source] += stats.Requests()
+		}
+	}
+	return total, bySource
+}
+
+// Checks that the recovery threshold and the minimum number of intervals avoid flapping alerts
+func TestLogMonitor_alertFlapping(t *testing.T) {
+	// The traffic hovers around the threshold of 10 req/s over 10s, which is 100 requests
+	flapping := []int{101, 99, 101, 99, 101, 99, 101, 99}
+	tests := []struct {
+		name             string
+		recoverThreshold int
+		forIntervals     int
+		traffic          []int
+		want             []bool
+	}{
+		// Without hysteresis, every crossing is an alert or a recovery
+		{"no hysteresis", 10, 1, flapping, []bool{true, false, true, false, true, false, true, false}},
+		// The traffic never goes below the recovery threshold
+		{"recover threshold", 8, 1, flapping, []bool{true}},
+		// The traffic never stays above the threshold for two intervals
+		{"for", 10, 2, flapping, []bool{}},
+		// Sustained traffic fires after two intervals, a short dip does not recover
+		{"for sustained", 10, 2, []int{101, 120, 130, 90, 110, 90, 80, 70}, []bool{true, false}},
+		// Both settings
+		{"both", 8, 3, []int{150, 150, 150, 90, 70, 90, 70, 70, 70}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alertChan := make(chan AlertRecord, len(tt.traffic))
+			monitor := newMonitor(t, context.Background(), nil, Config{TimeWindow: 10, UpdateInterval: 10, Threshold: 10}, nil, alertChan)
+			monitor.RecoverThreshold = tt.recoverThreshold
+			monitor.For = tt.forIntervals
+			for _, traffic := range tt.traffic {
+				monitor.AlertTraffic = []int{traffic}
+				monitor.Alert()
+			}
+			close(alertChan)
+			got := []bool{}
+			for alert := range alertChan {
+				got = append(got, alert.Alert)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Alert() sent %v, want %v", got, tt.want)
+			}
+		})
 	}
 }
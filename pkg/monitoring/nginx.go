@@ -0,0 +1,128 @@
+package monitoring
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NginxCombinedFormat is the log_format nginx uses when none is specified
+const NginxCombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// nginxVariable matches a variable of a log_format string, either $name or ${name}
+var nginxVariable = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+// nginxPatterns gives the pattern of the variables whose content is known
+// any other variable matches lazily up to the next literal of the format
+var nginxPatterns = map[string]string{
+	"remote_addr":     `\S+`,
+	"remote_user":     `\S+`,
+	"time_local":      `[^\]]+`,
+	"time_iso8601":    `\S+`,
+	"status":          `\d{3}`,
+	"body_bytes_sent": `\d+|-`,
+	"bytes_sent":      `\d+|-`,
+	"request_method":  `[A-Z]+`,
+	"request_time":    `\d+(?:\.\d+)?`,
+}
+
+// NginxParser parses lines written with a custom nginx log_format
+type NginxParser struct {
+	// regex compiled from the log_format, each variable is a capture group
+	regex *regexp.Regexp
+	// variables holds the name of the variable of each capture group
+	variables []string
+}
+
+// NewNginxParser compiles an nginx log_format string such as NginxCombinedFormat into a parser
+// An empty format falls back to NginxCombinedFormat
+func NewNginxParser(format string) (*NginxParser, error) {
+	if format == "" {
+		format = NginxCombinedFormat
+	}
+	var pattern strings.Builder
+	var variables []string
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range nginxVariable.FindAllStringSubmatchIndex(format, -1) {
+		pattern.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		name := ""
+		if loc[2] >= 0 {
+			name = format[loc[2]:loc[3]]
+		} else {
+			name = format[loc[4]:loc[5]]
+		}
+		if p, ok := nginxPatterns[name]; ok {
+			pattern.WriteString("(" + p + ")")
+		} else {
+			pattern.WriteString("(.*?)")
+		}
+		variables = append(variables, name)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]))
+	pattern.WriteString("$")
+
+	if len(variables) == 0 {
+		return nil, fmt.Errorf("nginx log_format %q has no variable", format)
+	}
+	regex, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid nginx log_format %q: %v", format, err)
+	}
+	return &NginxParser{regex: regex, variables: variables}, nil
+}
+
+// Parse parses a line written with the log_format of the parser
+func (p *NginxParser) Parse(line string) (*LogRecord, error) {
+	matches := p.regex.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, errInvalidFormat
+	}
+	record := &LogRecord{rfc931: "-"}
+	path := ""
+	for i, name := range p.variables {
+		value := matches[i+1]
+		switch name {
+		case "remote_addr":
+			record.remotehost = value
+		case "remote_user":
+			record.authuser = value
+		case "time_local", "time_iso8601":
+			date, err := parseDate(value)
+			if err != nil {
+				return nil, err
+			}
+			record.date = date
+		case "request":
+			method, requestPath, protocol, err := splitRequest(value)
+			if err != nil {
+				return nil, err
+			}
+			record.method = method
+			path = requestPath
+			record.protocol = protocol
+		case "request_method":
+			record.method = value
+		case "request_uri", "uri":
+			path = value
+		case "server_protocol":
+			record.protocol = value
+		case "status":
+			record.status = value
+		case "body_bytes_sent", "bytes_sent":
+			record.bytesCount = parseBytes(value)
+		case "http_referer":
+			record.referer = value
+		case "http_user_agent":
+			record.userAgent = value
+		case "request_time":
+			record.duration, record.timed = parseSeconds(value)
+		}
+	}
+	if record.method == "" || path == "" || record.date.IsZero() {
+		return nil, errInvalidFormat
+	}
+	record.section = Section(path)
+	return record, nil
+}
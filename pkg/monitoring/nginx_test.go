@@ -0,0 +1,95 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNginxParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    *LogRecord
+		wantErr bool
+	}{
+		// Default combined format
+		{"test0",
+			"",
+			"10.0.0.1 - - [27/Mar/2020:12:16:36 +0100] \"GET /api/users/1 HTTP/1.1\" 200 512 \"-\" \"curl/7.68.0\"",
+			&LogRecord{
+				remotehost: "10.0.0.1",
+				rfc931:     "-",
+				authuser:   "-",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
+				method:     "GET",
+				section:    "/api",
+				protocol:   "HTTP/1.1",
+				status:     "200",
+				bytesCount: 512,
+				referer:    "-",
+				userAgent:  "curl/7.68.0",
+			},
+			false,
+		},
+		// Custom format with braces, separated request fields, an unknown variable and the request duration
+		{"test1",
+			"${remote_addr} $time_iso8601 $request_method $uri $server_protocol $status $bytes_sent $request_time",
+			"10.0.0.2 2020-03-27T12:16:36+01:00 POST /login/form HTTP/2.0 302 0 0.004",
+			&LogRecord{
+				remotehost: "10.0.0.2",
+				rfc931:     "-",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
+				method:     "POST",
+				section:    "/login",
+				protocol:   "HTTP/2.0",
+				status:     "302",
+				duration:   4 * time.Millisecond,
+				timed:      true,
+			},
+			false,
+		},
+		// The status is not a number
+		{"test2",
+			"",
+			"10.0.0.1 - - [27/Mar/2020:12:16:36 +0100] \"GET /api/users/1 HTTP/1.1\" OK 512 \"-\" \"curl/7.68.0\"",
+			nil,
+			true,
+		},
+		// The date is not valid
+		{"test3",
+			"",
+			"10.0.0.1 - - [27/13/2020:12:16:36 +0100] \"GET /api/users/1 HTTP/1.1\" 200 512 \"-\" \"curl/7.68.0\"",
+			nil,
+			true,
+		},
+		// The format has no request
+		{"test4",
+			"$remote_addr $status",
+			"10.0.0.1 200",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewNginxParser(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parser.Parse(tt.input)
+			if !sameRecord(got, tt.want) {
+				t.Errorf("Parse() \ngot = %v \nwant %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewNginxParser(t *testing.T) {
+	if _, err := NewNginxParser("no variables here"); err == nil {
+		t.Errorf("NewNginxParser() should fail on a format without variables")
+	}
+}
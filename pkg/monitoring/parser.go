@@ -2,8 +2,11 @@ package monitoring
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // LogRecord gathers all the information about a parsed log line
@@ -15,7 +18,7 @@ type LogRecord struct {
 	// The username as which the user has authenticated himself.
 	authuser string
 	// Date and time of the request
-	date string
+	date time.Time
 	// Http verb used
 	method string
 	// Section of the request
@@ -26,10 +29,67 @@ type LogRecord struct {
 	protocol string
 	// The content-length of the document transferred
 	bytesCount int
+	// The Referer header sent by the client, only filled by formats that log it
+	referer string
+	// The User-Agent header sent by the client, only filled by formats that log it
+	userAgent string
+	// The log file the record was read from
+	source string
+	// Position of the log file after the line of the record
+	position FileState
+	// Time taken to serve the request, only meaningful when timed is true
+	duration time.Duration
+	// timed is true when the log format includes the duration of the request
+	timed bool
+}
+
+// Parser turns a raw log line into a LogRecord
+// Each supported log format has its own implementation
+type Parser interface {
+	Parse(line string) (*LogRecord, error)
+}
+
+// Names of the supported log formats, used by NewParser
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatNginx    = "nginx"
+	FormatJSON     = "json"
+	FormatCaddy    = "caddy"
+)
+
+// errInvalidFormat is returned by every parser when a line does not match its format
+var errInvalidFormat = errors.New("Invalid log format.")
+
+// NewParser returns the parser associated with the format name
+// logFormat is only used by the nginx format and holds the log_format string of the nginx configuration
+func NewParser(format string, logFormat string) (Parser, error) {
+	switch format {
+	case FormatCommon:
+		return CommonParser{}, nil
+	case FormatCombined:
+		return CombinedParser{}, nil
+	case FormatNginx:
+		return NewNginxParser(logFormat)
+	case FormatJSON:
+		return NewJSONParser(DefaultJSONFields), nil
+	case FormatCaddy:
+		return NewJSONParser(CaddyJSONFields), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
 }
 
 // Compile the regex once and use it for every log line
-var regex = regexp.MustCompile(`(\S+)\s+(\S+)\s+(\S+)\s+(\[.+\])\s+\"([A-Z]+)\s+(\/[^\/]+)\/.+\s+(\S+)\"\s+(\S+)\s+([0-9]+|-)(.+)?`)
+// The request is matched as in the combined format, the section is derived from its path
+var regex = regexp.MustCompile(`(\S+)\s+(\S+)\s+(\S+)\s+(\[[^\]]+\])\s+"([A-Z]+)\s+(\S+)\s+(\S+)"\s+(\S+)\s+([0-9]+|-)(.+)?`)
+
+// CommonParser parses lines written in the Common Log Format (w3c-formatted HTTP access log)
+type CommonParser struct{}
+
+// Parse parses a line in the Common Log Format
+func (CommonParser) Parse(line string) (*LogRecord, error) {
+	return ParseLogLine(line)
+}
 
 // ParseLogLine parses a log record according to the w3c-formatted HTTP access log and return the LogRecord associated
 func ParseLogLine(input string) (*LogRecord, error) {
@@ -38,27 +98,158 @@ func ParseLogLine(input string) (*LogRecord, error) {
 	matches := regex.FindStringSubmatch(input)
 	// if the log record is badly formatted, return an empty record as well as an error
 	if len(matches) != 11 {
-		return nil, errors.New("Invalid log format.")
+		return nil, errInvalidFormat
 	}
-	var bytes int
-	// If it is not a dash then it is a number
-	if matches[9] != "-" {
-		bytes, _ = strconv.Atoi(matches[9])
-		// A dash means that no bytes were transferred
-	} else {
-		bytes = 0
+	date, err := parseDate(matches[4])
+	if err != nil {
+		return nil, err
 	}
 
 	// return a new LogRecord instance
-	return &LogRecord{
+	record := &LogRecord{
+		remotehost: matches[1],
+		rfc931:     matches[2],
+		authuser:   matches[3],
+		date:       date,
+		method:     matches[5],
+		section:    Section(matches[6]),
+		protocol:   matches[7],
+		status:     matches[8],
+		bytesCount: parseBytes(matches[9]),
+	}
+	record.duration, record.timed = trailingDuration(matches[10])
+	return record, nil
+}
+
+// Compile the regex of the combined format once
+// It is the common log format followed by the quoted referer and user-agent
+var combinedRegex = regexp.MustCompile(`^(\S+)\s+(\S+)\s+(\S+)\s+(\[[^\]]+\])\s+"([A-Z]+)\s+(\S+)\s+(\S+)"\s+(\S+)\s+([0-9]+|-)\s+"((?:[^"\\]|\\.)*)"\s+"((?:[^"\\]|\\.)*)"(.*)`)
+
+// CombinedParser parses lines written in the Apache/nginx Combined Log Format
+type CombinedParser struct{}
+
+// Parse parses a line in the Combined Log Format
+func (CombinedParser) Parse(line string) (*LogRecord, error) {
+	matches := combinedRegex.FindStringSubmatch(line)
+	if len(matches) != 13 {
+		return nil, errInvalidFormat
+	}
+	date, err := parseDate(matches[4])
+	if err != nil {
+		return nil, err
+	}
+	record := &LogRecord{
 		remotehost: matches[1],
 		rfc931:     matches[2],
 		authuser:   matches[3],
-		date:       matches[4],
+		date:       date,
 		method:     matches[5],
-		section:    matches[6],
+		section:    Section(matches[6]),
 		protocol:   matches[7],
 		status:     matches[8],
-		bytesCount: bytes,
-	}, nil
+		bytesCount: parseBytes(matches[9]),
+		referer:    matches[10],
+		userAgent:  matches[11],
+	}
+	record.duration, record.timed = trailingDuration(matches[12])
+	return record, nil
+}
+
+// Section returns the section of a request path, which is what's before the second '/'
+// the query string is ignored: "/api/user?id=1" gives "/api" and "/?id=1" gives "/"
+func Section(path string) string {
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	if !strings.HasPrefix(path, "/") {
+		// Absolute URIs (proxies) or empty paths
+		if idx := strings.Index(path, "://"); idx >= 0 {
+			path = path[idx+3:]
+			if slash := strings.Index(path, "/"); slash >= 0 {
+				return Section(path[slash:])
+			}
+		}
+		return "/"
+	}
+	if idx := strings.Index(path[1:], "/"); idx >= 0 {
+		path = path[:idx+1]
+	}
+	return path
+}
+
+// splitRequest splits a request line such as "GET /index.html HTTP/1.1" into its method, path and protocol
+func splitRequest(request string) (method string, path string, protocol string, err error) {
+	fields := strings.Fields(request)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", "", "", errInvalidFormat
+	}
+	if len(fields) == 3 {
+		protocol = fields[2]
+	}
+	return fields[0], fields[1], protocol, nil
+}
+
+// parseBytes converts a byte count field to an int
+// A dash means that no bytes were transferred
+func parseBytes(field string) int {
+	if field == "-" {
+		return 0
+	}
+	bytes, _ := strconv.Atoi(field)
+	return bytes
+}
+
+// parseSeconds converts a duration in seconds such as nginx $request_time ("0.125") to a time.Duration
+// The second value is false if the field is not a number
+func parseSeconds(field string) (time.Duration, bool) {
+	seconds, err := strconv.ParseFloat(field, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// trailingDuration reads the request duration from the last field of the end of a line
+// A decimal number is a duration in seconds ($request_time of nginx)
+// an integer is a duration in microseconds (%D of Apache)
+// The second value is false if the line does not end with a duration
+func trailingDuration(rest string) (time.Duration, bool) {
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	field := fields[len(fields)-1]
+	if strings.Contains(field, ".") {
+		return parseSeconds(field)
+	}
+	microseconds, err := strconv.Atoi(field)
+	if err != nil || microseconds < 0 {
+		return 0, false
+	}
+	return time.Duration(microseconds) * time.Microsecond, true
+}
+
+// dateLayouts are the layouts tried in order to parse the date of a log line
+var dateLayouts = []string{
+	// Common log format
+	"02/Jan/2006:15:04:05 -0700",
+	// Common log format with the full month name, written by the generator
+	"02/January/2006:15:04:05 -0700",
+	// nginx $time_iso8601 and most JSON loggers
+	time.RFC3339Nano,
+}
+
+// parseDate parses the date of a log line, enclosing brackets are ignored
+// Dates given as a number are read as a Unix timestamp in seconds, as logged by Caddy
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Time{}, errInvalidFormat
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_parseLogLine(t *testing.T) {
@@ -22,7 +23,7 @@ func Test_parseLogLine(t *testing.T) {
 				remotehost: "53.120.219.15",
 				rfc931:     "-",
 				authuser:   "paul",
-				date:       "[27/March/2020:12:10:41 +0100]",
+				date:       time.Date(2020, 3, 27, 12, 10, 41, 0, time.FixedZone("", 3600)),
 				method:     "GET",
 				section:    "/posts",
 				protocol:   "HTTP/1.0",
@@ -38,7 +39,7 @@ func Test_parseLogLine(t *testing.T) {
 				remotehost: "141.146.202.67",
 				rfc931:     "-",
 				authuser:   "jill",
-				date:       "[27/March/2020:12:16:36 +0100]",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
 				method:     "PUT",
 				section:    "/login",
 				protocol:   "HTTP/1.0",
@@ -53,7 +54,7 @@ func Test_parseLogLine(t *testing.T) {
 				remotehost: "141.146.202.67",
 				rfc931:     "-",
 				authuser:   "jill",
-				date:       "[27/March/2020:12:16:36 +0100]",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
 				method:     "PUT",
 				section:    "/login",
 				protocol:   "HTTP/1.0",
@@ -69,7 +70,7 @@ func Test_parseLogLine(t *testing.T) {
 				remotehost: "141.146.202.67",
 				rfc931:     "1234",
 				authuser:   "jill",
-				date:       "[27/March/2020:12:16:36 +0100]",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
 				method:     "PUT",
 				section:    "/login",
 				protocol:   "HTTP/1.0",
@@ -96,13 +97,63 @@ func Test_parseLogLine(t *testing.T) {
 			nil,
 			errors.New("Invalid log format."),
 		},
+		// test with the duration of the request in microseconds (%D)
+		{"test8",
+			"53.120.219.15 - paul [27/March/2020:12:10:41 +0100] \"GET /posts/r/a/view.html HTTP/1.0\" 403 5026 1250",
+			&LogRecord{
+				remotehost: "53.120.219.15",
+				rfc931:     "-",
+				authuser:   "paul",
+				date:       time.Date(2020, 3, 27, 12, 10, 41, 0, time.FixedZone("", 3600)),
+				method:     "GET",
+				section:    "/posts",
+				protocol:   "HTTP/1.0",
+				status:     "403",
+				bytesCount: 5026,
+				duration:   1250 * time.Microsecond,
+				timed:      true,
+			},
+			nil,
+		},
+		// test with a single path segment, the canonical example of the Common Log Format
+		{"test9",
+			"127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] \"GET /apache_pb.gif HTTP/1.0\" 200 2326",
+			&LogRecord{
+				remotehost: "127.0.0.1",
+				rfc931:     "-",
+				authuser:   "frank",
+				date:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -25200)),
+				method:     "GET",
+				section:    "/apache_pb.gif",
+				protocol:   "HTTP/1.0",
+				status:     "200",
+				bytesCount: 2326,
+			},
+			nil,
+		},
+		// test with the root path
+		{"test10",
+			"127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.0\" 304 -",
+			&LogRecord{
+				remotehost: "127.0.0.1",
+				rfc931:     "-",
+				authuser:   "-",
+				date:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -25200)),
+				method:     "GET",
+				section:    "/",
+				protocol:   "HTTP/1.0",
+				status:     "304",
+				bytesCount: 0,
+			},
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := ParseLogLine(tt.input)
 
-			if !reflect.DeepEqual(got, tt.want) {
+			if !sameRecord(got, tt.want) {
 				t.Errorf("parseLogLine() \ngot = %v \nwant %v", got, tt.want)
 			}
 			if !reflect.DeepEqual(err, tt.wantErr) {
@@ -112,3 +163,196 @@ func Test_parseLogLine(t *testing.T) {
 		})
 	}
 }
+
+func TestCombinedParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *LogRecord
+		wantErr error
+	}{
+		{"test0",
+			"127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] \"GET /apache_pb.gif HTTP/1.0\" 200 2326 \"http://www.example.com/start.html\" \"Mozilla/4.08 [en] (Win98; I ;Nav)\"",
+			&LogRecord{
+				remotehost: "127.0.0.1",
+				rfc931:     "-",
+				authuser:   "frank",
+				date:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -25200)),
+				method:     "GET",
+				section:    "/apache_pb.gif",
+				protocol:   "HTTP/1.0",
+				status:     "200",
+				bytesCount: 2326,
+				referer:    "http://www.example.com/start.html",
+				userAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			},
+			nil,
+		},
+		{"test1",
+			"141.146.202.67 - - [27/March/2020:12:16:36 +0100] \"PUT /login/user?id=123 HTTP/1.1\" 304 - \"-\" \"curl/7.68.0\"",
+			&LogRecord{
+				remotehost: "141.146.202.67",
+				rfc931:     "-",
+				authuser:   "-",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
+				method:     "PUT",
+				section:    "/login",
+				protocol:   "HTTP/1.1",
+				status:     "304",
+				bytesCount: 0,
+				referer:    "-",
+				userAgent:  "curl/7.68.0",
+			},
+			nil,
+		},
+		// nginx combined format followed by $request_time
+		{"test3",
+			"141.146.202.67 - - [27/March/2020:12:16:36 +0100] \"GET /api/users HTTP/1.1\" 200 12 \"-\" \"curl/7.68.0\" 0.250",
+			&LogRecord{
+				remotehost: "141.146.202.67",
+				rfc931:     "-",
+				authuser:   "-",
+				date:       time.Date(2020, 3, 27, 12, 16, 36, 0, time.FixedZone("", 3600)),
+				method:     "GET",
+				section:    "/api",
+				protocol:   "HTTP/1.1",
+				status:     "200",
+				bytesCount: 12,
+				referer:    "-",
+				userAgent:  "curl/7.68.0",
+				duration:   250 * time.Millisecond,
+				timed:      true,
+			},
+			nil,
+		},
+		// A common log line has no referer nor user-agent
+		{"test2",
+			"53.120.219.15 - paul [27/March/2020:12:10:41 +0100] \"GET /posts/r/a/view.html HTTP/1.0\" 403 5026",
+			nil,
+			errors.New("Invalid log format."),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CombinedParser{}.Parse(tt.input)
+			if !sameRecord(got, tt.want) {
+				t.Errorf("Parse() \ngot = %v \nwant %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Parse() err \ngot = %v \nwant %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_trailingDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      time.Duration
+		wantTimed bool
+	}{
+		{"test0", "", 0, false},
+		{"test1", " 0.125", 125 * time.Millisecond, true},
+		{"test2", " 3000", 3 * time.Millisecond, true},
+		{"test3", ` "-" "curl/7.68.0"`, 0, false},
+		{"test4", ` "-" "curl/7.68.0" 1.5`, 1500 * time.Millisecond, true},
+		{"test5", " -", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, timed := trailingDuration(tt.input)
+			if got != tt.want || timed != tt.wantTimed {
+				t.Errorf("trailingDuration() = %v, %v, want %v, %v", got, timed, tt.want, tt.wantTimed)
+			}
+		})
+	}
+}
+
+func TestSection(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"test0", "/posts/r/a/view.html", "/posts"},
+		{"test1", "/login/user?id=123", "/login"},
+		{"test2", "/home", "/home"},
+		{"test3", "/", "/"},
+		{"test4", "/?id=1/2", "/"},
+		{"test5", "http://example.com/api/v1", "/api"},
+		{"test6", "*", "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Section(tt.input); got != tt.want {
+				t.Errorf("Section() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{"test0", FormatCommon, false},
+		{"test1", FormatCombined, false},
+		{"test2", FormatNginx, false},
+		{"test3", FormatJSON, false},
+		{"test4", FormatCaddy, false},
+		{"test5", "haproxy", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewParser(tt.format, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewParser() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got == nil {
+				t.Errorf("NewParser() returned a nil parser")
+			}
+		})
+	}
+}
+
+// sameRecord compares two records, the dates are equal if they are the same instant whatever their location
+func sameRecord(got, want *LogRecord) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	if !got.date.Equal(want.date) {
+		return false
+	}
+	gotCopy, wantCopy := *got, *want
+	gotCopy.date, wantCopy.date = time.Time{}, time.Time{}
+	return reflect.DeepEqual(gotCopy, wantCopy)
+}
+
+func Test_parseDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"test0", "[10/Oct/2000:13:55:36 -0700]", time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC), false},
+		{"test1", "[27/March/2020:12:16:36 +0100]", time.Date(2020, 3, 27, 11, 16, 36, 0, time.UTC), false},
+		{"test2", "2020-03-27T12:16:36+01:00", time.Date(2020, 3, 27, 11, 16, 36, 0, time.UTC), false},
+		{"test3", "1585307796.5", time.Date(2020, 3, 27, 11, 16, 36, 500000000, time.UTC), false},
+		{"test4", "[yesterday]", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDate(tt.input)
+			if !got.Equal(tt.want) {
+				t.Errorf("parseDate() = %v, want %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
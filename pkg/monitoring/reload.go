@@ -0,0 +1,174 @@
+package monitoring
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reload is a change of the settings sent by Reload
+type reload struct {
+	config Config
+	rules  []*ruleState
+}
+
+// Reload changes the alerting settings of the running monitor without losing its alerting window nor its alerts:
+// the thresholds, For, the time window, the update interval and the alert rules
+// The other settings of config, such as the log files, the parser or the StateFile, are ignored, they need a restart
+// The settings are checked first, nothing changes if they are not valid
+// The change is applied by the goroutine of Run or Replay, which sends an AlertRecord with Reload describing it
+func (m *LogMonitor) Reload(config Config, rules []Rule) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	states, err := newRuleStates(rules, config.UpdateInterval)
+	if err != nil {
+		return err
+	}
+	select {
+	case m.reloads <- reload{config: config.withDefaults(), rules: states}:
+		return nil
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	}
+}
+
+// applyReload applies the settings of r at now
+// With a new update interval, the open intervals are reported first, the current one as partial,
+// and the intervals are numbered again from the one containing now
+// The alerting window is resampled to the new intervals, the windows of the rules are kept if the intervals are unchanged
+func (m *LogMonitor) applyReload(r reload, now time.Time) {
+	changes := m.reloadChanges(r)
+	config := r.config
+	sameIntervals := config.UpdateInterval == m.UpdateInterval
+	next := m.next
+	if !sameIntervals {
+		m.flush(now)
+		m.flushing = false
+		next = now.Unix() / int64(config.UpdateInterval)
+	}
+	traffic, intervals := m.resampleWindow(config.UpdateInterval, config.TimeWindow/config.UpdateInterval, next)
+	m.UpdateInterval = config.UpdateInterval
+	m.TimeWindow = config.TimeWindow
+	m.Threshold = config.Threshold
+	m.RecoverThreshold = config.RecoverThreshold
+	m.For = config.For
+	m.alertPending = 0
+	m.AlertTraffic = traffic
+	m.AlertIntervals = intervals
+	m.next = next
+	m.AlertIndex = int(m.next % int64(len(m.AlertTraffic)))
+
+	// The rules kept carry their alert state over, an active alert of a removed rule recovers
+	for _, rule := range r.rules {
+		if old := m.rule(rule.Name); old != nil {
+			rule.inAlert = old.inAlert
+			if sameIntervals {
+				rule.keepSamples(old)
+			}
+		}
+	}
+	removed := m.rules
+	m.rules = r.rules
+	for _, old := range removed {
+		if old.inAlert && m.rule(old.Name) == nil {
+			m.sendAlert(AlertRecord{Time: now, Rule: old.Name, Threshold: old.Threshold, Severity: old.Severity})
+		}
+	}
+	m.sendAlert(AlertRecord{Time: now, Reload: changes})
+}
+
+// reloadChanges describes the settings changed by r
+func (m *LogMonitor) reloadChanges(r reload) string {
+	var changes []string
+	change := func(name string, from int, to int, unit string) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %d%s (was %d%s)", name, to, unit, from, unit))
+		}
+	}
+	change("threshold", m.Threshold, r.config.Threshold, "")
+	change("recover", m.RecoverThreshold, r.config.RecoverThreshold, "")
+	change("for", m.For, r.config.For, "")
+	change("timewindow", m.TimeWindow, r.config.TimeWindow, "s")
+	change("updateInterval", m.UpdateInterval, r.config.UpdateInterval, "s")
+	var added, removed []string
+	for _, rule := range r.rules {
+		if m.rule(rule.Name) == nil {
+			added = append(added, rule.Name)
+		}
+	}
+	for _, rule := range m.rules {
+		found := false
+		for _, kept := range r.rules {
+			found = found || kept.Name == rule.Name
+		}
+		if !found {
+			removed = append(removed, rule.Name)
+		}
+	}
+	if len(added) > 0 {
+		changes = append(changes, "rules added: "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "rules removed: "+strings.Join(removed, ", "))
+	}
+	if len(changes) == 0 {
+		return "no change"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// resampleWindow spreads the traffic of the alerting window over intervals of updateInterval seconds
+// The result is a window of size intervals ending with interval last, the next one to close
+// The traffic of an interval is shared between the new intervals it overlaps, in proportion to the overlap
+func (m *LogMonitor) resampleWindow(updateInterval int, size int, last int64) ([]int, []int64) {
+	traffic := make([]int, size)
+	intervals := make([]int64, size)
+	newInterval := int64(updateInterval)
+	oldInterval := int64(m.UpdateInterval)
+	for i, n := range m.AlertIntervals {
+		count := m.AlertTraffic[i]
+		if count == 0 {
+			continue
+		}
+		start, end := n*oldInterval, (n+1)*oldInterval
+		overlap, shared := int64(0), 0
+		for k := start / newInterval; k*newInterval < end; k++ {
+			from, to := k*newInterval, (k+1)*newInterval
+			if from < start {
+				from = start
+			}
+			if to > end {
+				to = end
+			}
+			// The shares are rounded so that they sum up to count
+			overlap += to - from
+			share := int(int64(count)*overlap/oldInterval) - shared
+			shared += share
+			if k <= last-int64(size) || k > last {
+				continue
+			}
+			idx := int(k % int64(size))
+			if intervals[idx] != k {
+				traffic[idx] = 0
+				intervals[idx] = k
+			}
+			traffic[idx] += share
+		}
+	}
+	return traffic, intervals
+}
+
+// keepSamples copies the most recent samples of old in the window of the rule, as many as it holds
+func (r *ruleState) keepSamples(old *ruleState) {
+	kept := len(old.samples)
+	if kept > len(r.samples) {
+		kept = len(r.samples)
+	}
+	// The oldest sample of old is at its index
+	first := old.index + len(old.samples) - kept
+	for i := 0; i < kept; i++ {
+		r.samples[i] = old.samples[(first+i)%len(old.samples)]
+	}
+	r.index = kept % len(r.samples)
+}
@@ -0,0 +1,144 @@
+package monitoring
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Checks that the traffic of the alerting window is spread over the new intervals
+func TestLogMonitor_resampleWindow(t *testing.T) {
+	tests := []struct {
+		name           string
+		updateInterval int
+		size           int
+		last           int64
+		wantTraffic    []int
+		wantIntervals  []int64
+	}{
+		// Same intervals, the oldest one leaves the window
+		{"test0", 10, 3, 103, []int{90, 0, 60}, []int64{102, 0, 101}},
+		// Same intervals in a larger window
+		{"test1", 10, 6, 103, []int{90, 0, 0, 0, 30, 60}, []int64{102, 0, 0, 0, 100, 101}},
+		// Each interval is split in two
+		{"test2", 5, 6, 206, []int{45, 45, 0, 15, 30, 30}, []int64{204, 205, 0, 201, 202, 203}},
+		// The intervals are merged, the current one is still open
+		{"test3", 30, 1, 34, []int{90}, []int64{34}},
+		// The intervals overlap the new ones
+		{"test4", 15, 2, 68, []int{90, 75}, []int64{68, 67}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := newMonitor(t, context.Background(), nil, Config{TimeWindow: 30, UpdateInterval: 10, Threshold: 10}, nil, nil)
+			// Intervals 100 to 102 start at 1000s, 1010s and 1020s
+			monitor.AlertTraffic = []int{90, 30, 60}
+			monitor.AlertIntervals = []int64{102, 100, 101}
+			traffic, intervals := monitor.resampleWindow(tt.updateInterval, tt.size, tt.last)
+			if !reflect.DeepEqual(traffic, tt.wantTraffic) || !reflect.DeepEqual(intervals, tt.wantIntervals) {
+				t.Errorf("resampleWindow() = %v %v, want %v %v", traffic, intervals, tt.wantTraffic, tt.wantIntervals)
+			}
+		})
+	}
+}
+
+// Checks that a reload keeps the alerting window and the alerts, and is recorded
+func TestLogMonitor_applyReload(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) *LogRecord {
+		return &LogRecord{date: start.Add(time.Duration(seconds) * time.Second), section: "/a", method: "GET", status: "200"}
+	}
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, context.Background(), nil, Config{TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, statChan, alertChan)
+	rules := []Rule{{Name: "api", Metric: MetricRequests, Window: "10s", Threshold: 1}}
+	if err := monitor.SetRules(append(rules, Rule{Name: "old", Metric: MetricRequests, Window: "10s", Threshold: 1})); err != nil {
+		t.Fatal(err)
+	}
+	monitor.Start(start)
+	// 40 requests in each of the first two intervals fire every alert
+	for i := 0; i < 80; i++ {
+		monitor.add(at(i / 4))
+	}
+	monitor.CloseIntervals(start.Add(20 * time.Second))
+	if len(alertChan) != 3 || len(statChan) != 2 {
+		t.Fatalf("%d alerts and %d statistics, want 3 and 2", len(alertChan), len(statChan))
+	}
+	for len(alertChan) > 0 {
+		<-alertChan
+	}
+	for len(statChan) > 0 {
+		<-statChan
+	}
+	for i := 0; i < 10; i++ {
+		monitor.add(at(25))
+	}
+
+	// A larger window, the old rule recovers as it is removed
+	states, err := newRuleStates(rules, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.applyReload(reload{config: Config{TimeWindow: 60, UpdateInterval: 10, Threshold: 1}.withDefaults(), rules: states}, start.Add(25*time.Second))
+	if got := <-alertChan; got.Rule != "old" || got.Alert {
+		t.Errorf("applyReload() alert = %v, want the recovery of old", got)
+	}
+	if got := <-alertChan; got.Reload != "timewindow 60s (was 30s), rules removed: old" {
+		t.Errorf("applyReload() reload = %q", got.Reload)
+	}
+	if len(monitor.AlertTraffic) != 6 || monitor.windowTraffic() != 80 || !monitor.InAlert || !monitor.rule("api").inAlert {
+		t.Errorf("applyReload() window = %v, alert = %v", monitor.AlertTraffic, monitor.InAlert)
+	}
+	if _, ok := monitor.active["old"]; ok {
+		t.Errorf("applyReload() removed rule still active")
+	}
+
+	// Shorter intervals, the current one is reported as partial
+	states, _ = newRuleStates(rules, 5)
+	monitor.applyReload(reload{config: Config{TimeWindow: 60, UpdateInterval: 5, Threshold: 1}.withDefaults(), rules: states}, start.Add(25*time.Second))
+	if got := <-statChan; !got.Partial || got.NumRequests != 10 {
+		t.Errorf("applyReload() partial statistics = %v", got)
+	}
+	if got := <-alertChan; got.Reload != "updateInterval 5s (was 10s)" {
+		t.Errorf("applyReload() reload = %q", got.Reload)
+	}
+	if len(monitor.AlertTraffic) != 12 || monitor.windowTraffic() != 90 || monitor.next != monitor.intervalOf(start.Add(25*time.Second)) {
+		t.Errorf("applyReload() window = %v, next = %d", monitor.AlertTraffic, monitor.next)
+	}
+	// The next interval adds its traffic to what was already counted
+	monitor.add(at(27))
+	monitor.CloseIntervals(start.Add(30 * time.Second))
+	if got := <-statChan; got.Partial || got.NumRequests != 1 || got.WindowTraffic != 91 {
+		t.Errorf("statistics after reload = %v", got)
+	}
+	// The rule kept its alert state, it recovers with its window made of the new intervals
+	if got := <-alertChan; got.Rule != "api" || got.Alert {
+		t.Errorf("alert after reload = %v, want the recovery of api", got)
+	}
+}
+
+// Checks that Reload rejects invalid settings and hands the valid ones to the goroutine owning the monitor
+func TestLogMonitor_Reload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	monitor := newMonitor(t, ctx, cancel, Config{TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, nil, nil)
+
+	if err := monitor.Reload(Config{TimeWindow: 25, UpdateInterval: 10}, nil); err == nil || !strings.Contains(err.Error(), "multiple") {
+		t.Errorf("Reload() error = %v, want a window error", err)
+	}
+	if err := monitor.Reload(Config{TimeWindow: 30, UpdateInterval: 10}, []Rule{{Name: "a", Metric: MetricRequests, Window: "15s"}}); err == nil {
+		t.Errorf("Reload() accepted an invalid rule")
+	}
+	go func() {
+		if err := monitor.Reload(Config{TimeWindow: 60, UpdateInterval: 10, Threshold: 20}, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	if r := <-monitor.reloads; r.config.Threshold != 20 || r.config.RecoverThreshold != 20 || r.config.For != 1 {
+		t.Errorf("Reload() sent %v", r.config)
+	}
+	cancel()
+	if err := monitor.Reload(Config{TimeWindow: 60, UpdateInterval: 10}, nil); err != context.Canceled {
+		t.Errorf("Reload() error = %v after the cancellation", err)
+	}
+}
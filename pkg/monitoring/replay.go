@@ -0,0 +1,196 @@
+package monitoring
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// maxLineSize is the size of the longest line the replay is able to read
+const maxLineSize = 1024 * 1024
+
+// replayFile reads the records of a log file one by one during a replay
+// With Rotated, the archives of the file are read first, as if they were a single file
+type replayFile struct {
+	name string
+	// files still to read after the current one, oldest first
+	segments []string
+	reader   io.ReadCloser
+	scanner  *bufio.Scanner
+	// next record of the file, nil once the whole file has been read
+	next *LogRecord
+}
+
+// nextSegment opens the next file of the series, it returns false once every file has been read
+func (f *replayFile) nextSegment() (bool, error) {
+	f.close()
+	if len(f.segments) == 0 {
+		return false, nil
+	}
+	reader, err := OpenLog(f.segments[0])
+	if err != nil {
+		return false, err
+	}
+	f.segments = f.segments[1:]
+	f.reader = reader
+	f.scanner = bufio.NewScanner(reader)
+	f.scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return true, nil
+}
+
+// close closes the file being read
+func (f *replayFile) close() {
+	if f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+}
+
+// Replay reads the whole log files from their beginning instead of following them
+// The time is simulated from the dates of the logs so the StatRecords and AlertRecords are the same
+// as the ones the live monitor would have sent while the files were written
+// The records of several files are merged by date
+// With Rotated, the rotated archives of each file are replayed before it, compressed archives included
+// speed is the speed multiplier of the simulated time, 0 replays the files as fast as possible
+// StatChan and AlertChan are closed once the last interval has been reported
+// If the replay is cancelled, the intervals read so far are reported, the current one as partial
+func (m *LogMonitor) Replay(speed float64) {
+	defer close(m.StatChan)
+	defer close(m.AlertChan)
+	go m.abandonAfter(m.ShutdownTimeout)
+
+	quarantine, err := m.openQuarantine()
+	if err != nil {
+		m.abort(err)
+		return
+	}
+	if quarantine != nil {
+		defer quarantine.Close()
+	}
+	files := make([]*replayFile, 0, len(m.LogFiles))
+	for _, logFile := range m.LogFiles {
+		segments := []string{logFile}
+		if m.Rotated {
+			if segments, err = RotatedFiles(logFile); err != nil {
+				m.abort(err)
+				return
+			}
+		}
+		file := &replayFile{name: logFile, segments: segments}
+		defer file.close()
+		if _, err := file.nextSegment(); err != nil {
+			m.abort(err)
+			return
+		}
+		files = append(files, file)
+	}
+	for _, f := range files {
+		if err := m.advance(f, quarantine); err != nil {
+			m.abort(err)
+			return
+		}
+	}
+
+	// now is the simulated time, it is the most recent date read so far
+	var now time.Time
+	for m.ctx.Err() == nil {
+		// Take the file whose next record is the oldest
+		var oldest *replayFile
+		for _, f := range files {
+			if f.next != nil && (oldest == nil || f.next.date.Before(oldest.next.date)) {
+				oldest = f
+			}
+		}
+		if oldest == nil {
+			break
+		}
+		record := oldest.next
+		if err := m.advance(oldest, quarantine); err != nil {
+			m.abort(err)
+			return
+		}
+
+		if now.IsZero() {
+			m.Start(record.date)
+			now = record.date
+		}
+		n := m.intervalOf(record.date)
+		if m.future(record.date, time.Now()) {
+			// A record cannot be written after the real time, the simulated time does not jump to its wrong date
+			n = m.intervalOf(now)
+		} else if record.date.After(now) {
+			// A cancelled sleep ends the replay once the record has been added
+			m.sleep(record.date.Sub(now), speed)
+			now = record.date
+		}
+		m.addTo(n, record)
+		m.CloseIntervals(now.Add(-m.Lateness))
+		// A reload applies at the simulated time
+		select {
+		case r := <-m.reloads:
+			m.applyReload(r, now)
+		default:
+		}
+	}
+	if now.IsZero() {
+		return
+	}
+	// Report the intervals still open, the last one included
+	if m.ctx.Err() != nil {
+		m.flush(now)
+		return
+	}
+	// The file is over, no late record can come: the Lateness is not waited for, which would report empty intervals
+	m.CloseIntervals(m.intervalStart(m.intervalOf(now) + 1))
+}
+
+// advance reads the next record of f, malformed lines are handled with the ErrorPolicy
+// f.next is nil at the end of the last file of the series
+func (m *LogMonitor) advance(f *replayFile, quarantine *os.File) error {
+	f.next = nil
+	for {
+		if err := m.scan(f, quarantine); err != nil || f.next != nil {
+			return err
+		}
+		if ok, err := f.nextSegment(); !ok {
+			return err
+		}
+	}
+}
+
+// scan reads the next record of the current file of f, f.next is nil at its end
+func (m *LogMonitor) scan(f *replayFile, quarantine *os.File) error {
+	for f.scanner.Scan() {
+		record, err := m.Parser.Parse(f.scanner.Text())
+		if err != nil {
+			counted, err := m.handleParseError(f.scanner.Text(), err, quarantine)
+			if err != nil {
+				return err
+			}
+			if counted {
+				m.ParseErrors++
+			}
+			continue
+		}
+		record.source = f.name
+		record.remotehost = AnonymizeHost(record.remotehost, m.Anonymization, m.HashKey)
+		f.next = record
+		return nil
+	}
+	return f.scanner.Err()
+}
+
+// sleep waits for the simulated duration d at the given speed
+// It returns early if the monitor is cancelled in the meantime
+func (m *LogMonitor) sleep(d time.Duration, speed float64) {
+	if speed <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Duration(float64(d) / speed))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-m.ctx.Done():
+	}
+}
@@ -0,0 +1,262 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeReplayLog writes a log file with counts[i] requests at the second i after start
+func writeReplayLog(t *testing.T, name string, start time.Time, counts []int) {
+	var lines strings.Builder
+	for second, count := range counts {
+		date := start.Add(time.Duration(second) * time.Second).Format("[02/Jan/2006:15:04:05 -0700]")
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(&lines, "127.0.0.1 - james %s \"GET /api/user/%d HTTP/1.0\" 200 100\n", date, i)
+		}
+	}
+	if err := ioutil.WriteFile(name, []byte(lines.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogMonitor_Replay(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	// 5s intervals: 5, 50, 0, 0 and 1 requests
+	counts := make([]int, 21)
+	counts[1], counts[4] = 2, 3
+	counts[5], counts[9] = 25, 25
+	counts[20] = 1
+	writeReplayLog(t, "replay.log", start, counts)
+	defer os.Remove("replay.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord)
+	alertChan := make(chan AlertRecord)
+	// Alert above 2 requests per second over 10 seconds
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"replay.log"}, TimeWindow: 10, UpdateInterval: 5, Threshold: 2}, statChan, alertChan)
+	go monitor.Replay(0)
+
+	var stats []int
+	var alerts []AlertRecord
+	for statChan != nil || alertChan != nil {
+		select {
+		case stat, ok := <-statChan:
+			if !ok {
+				statChan = nil
+				continue
+			}
+			stats = append(stats, stat.NumRequests)
+		case alert, ok := <-alertChan:
+			if !ok {
+				alertChan = nil
+				continue
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+
+	if fmt.Sprint(stats) != fmt.Sprint([]int{5, 50, 0, 0, 1}) {
+		t.Errorf("Replay() sent %v requests, want [5 50 0 0 1]", stats)
+	}
+	want := []AlertRecord{
+		{Alert: true, NumTraffic: 55, Time: start.Add(10 * time.Second)},
+		{Alert: false, NumTraffic: 0, Time: start.Add(20 * time.Second)},
+	}
+	if len(alerts) != len(want) {
+		t.Fatalf("Replay() sent alerts %v, want %v", alerts, want)
+	}
+	for i := range want {
+		if alerts[i].Alert != want[i].Alert || alerts[i].NumTraffic != want[i].NumTraffic || !alerts[i].Time.Equal(want[i].Time) {
+			t.Errorf("Replay() alert %d = %v, want %v", i, alerts[i], want[i])
+		}
+	}
+	if err := monitor.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+// Checks that the speed multiplier slows down the replay
+func TestLogMonitor_ReplaySpeed(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	writeReplayLog(t, "replay_speed.log", start, []int{1, 1, 1})
+	defer os.Remove("replay_speed.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"replay_speed.log"}, TimeWindow: 10, UpdateInterval: 1, Threshold: 10}, statChan, alertChan)
+
+	// 2 seconds of logs replayed 4 times faster
+	begin := time.Now()
+	monitor.Replay(4)
+	if elapsed := time.Since(begin); elapsed < 500*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Replay() took %v, want about 500ms", elapsed)
+	}
+	if len(statChan) != 3 {
+		t.Errorf("Replay() sent %d stats, want 3", len(statChan))
+	}
+}
+
+// Checks that the records of several files are merged by date and broken down by file
+func TestLogMonitor_ReplayFiles(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	// The first file is busy at the beginning, the second one at the end
+	writeReplayLog(t, "replay_a.log", start, []int{4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1})
+	writeReplayLog(t, "replay_b.log", start, []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 6})
+	defer os.Remove("replay_a.log")
+	defer os.Remove("replay_b.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	// 5s intervals, alert above 1 request per second over 5 seconds
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"replay_a.log", "replay_b.log"}, TimeWindow: 5, UpdateInterval: 5, Threshold: 1}, statChan, alertChan)
+	monitor.Replay(0)
+
+	var stats []StatRecord
+	for stat := range statChan {
+		stats = append(stats, stat)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("Replay() sent %d stats, want 3", len(stats))
+	}
+	tests := []struct {
+		stat int
+		file string
+		want int
+	}{
+		{0, "replay_a.log", 4},
+		{0, "replay_b.log", 0},
+		{2, "replay_a.log", 1},
+		{2, "replay_b.log", 6},
+	}
+	for _, tt := range tests {
+		if got := stats[tt.stat].Sources[tt.file].NumRequests; got != tt.want {
+			t.Errorf("stat %d of %s: got %d requests, want %d", tt.stat, tt.file, got, tt.want)
+		}
+	}
+	if stats[2].NumRequests != 7 {
+		t.Errorf("last stat: got %d requests, want 7", stats[2].NumRequests)
+	}
+	// Only the last interval is above the threshold, had the files been read one after the other
+	// the records of the second file would have been late
+	if len(alertChan) != 1 {
+		t.Errorf("Replay() sent %d alerts, want 1", len(alertChan))
+	}
+}
+
+// Checks that a record dated in the future does not make the simulated time jump to its date
+func TestLogMonitor_ReplayFuture(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	writeReplayLog(t, "replay_future.log", start, []int{2, 0, 0, 0, 0, 0, 0, 3})
+	defer os.Remove("replay_future.log")
+	// A line of the year 2099 in the middle of the file
+	data, err := ioutil.ReadFile("replay_future.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := "127.0.0.1 - james [27/Mar/2099:12:00:04 +0000] \"GET /api/user HTTP/1.0\" 200 100\n"
+	lines := strings.SplitAfterN(string(data), "\n", 3)
+	if err := ioutil.WriteFile("replay_future.log", []byte(lines[0]+lines[1]+future+lines[2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"replay_future.log"}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, statChan, alertChan)
+	monitor.Replay(0)
+
+	var stats []int
+	for stat := range statChan {
+		stats = append(stats, stat.NumRequests)
+	}
+	// The record of 2099 is counted in the first interval, the one of the simulated time when it was read
+	if fmt.Sprint(stats) != fmt.Sprint([]int{3, 3}) {
+		t.Errorf("Replay() sent %v requests, want [3 3]", stats)
+	}
+}
+
+// Checks that the Lateness does not report empty intervals after the last record
+func TestLogMonitor_ReplayLateness(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	writeReplayLog(t, "replay_lateness.log", start, []int{0, 1})
+	defer os.Remove("replay_lateness.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 10)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"replay_lateness.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 10, Lateness: 25 * time.Second}, statChan, alertChan)
+	monitor.Replay(0)
+
+	var stats []StatRecord
+	for stat := range statChan {
+		stats = append(stats, stat)
+	}
+	if len(stats) != 1 || stats[0].NumRequests != 1 || !stats[0].Time.Equal(start) {
+		t.Errorf("Replay() sent %v, want a single interval of 1 request at %v", stats, start)
+	}
+}
+
+// Checks that the remote hosts are anonymised before being aggregated
+func TestLogMonitor_ReplayAnonymized(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	writeReplayLog(t, "anonymized.log", start, []int{3})
+	defer os.Remove("anonymized.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord)
+	alertChan := make(chan AlertRecord, 10)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"anonymized.log"}, TimeWindow: 10, UpdateInterval: 5, Threshold: 2}, statChan, alertChan)
+	monitor.Anonymization = AnonymizeTruncate
+	go monitor.Replay(0)
+
+	var hosts []Pair
+	for stat := range statChan {
+		hosts = append(hosts, stat.TopHosts...)
+	}
+	if fmt.Sprint(hosts) != fmt.Sprint([]Pair{{"127.0.0.0", 3}}) {
+		t.Errorf("Replay() top hosts = %v, want [{127.0.0.0 3}]", hosts)
+	}
+}
+
+// BenchmarkLogMonitor_Replay measures the throughput of the monitor, from the parsing to the statistics
+func BenchmarkLogMonitor_Replay(b *testing.B) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	// 100000 lines over 100 seconds, from 1000 hosts
+	var lines strings.Builder
+	for second := 0; second < 100; second++ {
+		date := start.Add(time.Duration(second) * time.Second).Format("[02/Jan/2006:15:04:05 -0700]")
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(&lines, "10.0.%d.%d - james %s \"GET /api%d/user/%d HTTP/1.0\" 200 100 %d\n", i%4, i%250, date, i%20, i, 1000+i)
+		}
+	}
+	if err := ioutil.WriteFile("benchmark.log", []byte(lines.String()), 0600); err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove("benchmark.log")
+
+	b.SetBytes(int64(lines.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		statChan := make(chan StatRecord)
+		alertChan := make(chan AlertRecord, 100)
+		monitor := newMonitor(b, ctx, cancel, Config{LogFiles: []string{"benchmark.log"}, TimeWindow: 120, UpdateInterval: 10, Threshold: 10}, statChan, alertChan)
+		go monitor.Replay(0)
+		for range statChan {
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,279 @@
+package monitoring
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Metrics an alert rule can watch
+const (
+	// MetricRequests is the number of requests per second
+	MetricRequests = "requests"
+	// MetricStatus is the percentage of requests whose status class is Match, for instance "5xx"
+	MetricStatus = "status"
+	// MetricSection is the number of requests per second of the section Match, for instance "/api"
+	MetricSection = "section"
+	// MetricBytes is the number of bytes transferred per second
+	MetricBytes = "bytes"
+	// MetricHost is the number of requests per minute of the busiest remote host
+	MetricHost = "host"
+)
+
+// Rule is an alert rule, it is evaluated at the end of each interval over its own window
+type Rule struct {
+	// Name of the rule, displayed with its alerts
+	Name string `yaml:"name" toml:"name"`
+	// Metric watched by the rule, see the Metric constants
+	Metric string `yaml:"metric" toml:"metric"`
+	// Status class or section watched by the status and section metrics
+	Match string `yaml:"match" toml:"match"`
+	// Time window over which the metric is computed, for instance "5m"
+	// It must be a multiple of the update interval
+	Window string `yaml:"window" toml:"window"`
+	// The rule fires when the metric goes above Threshold
+	Threshold float64 `yaml:"threshold" toml:"threshold"`
+	// The rule recovers when the metric goes below Recover, Threshold is used if it is not set or negative
+	// As with the recover setting of the monitor, 0 is rejected: no metric goes below 0, the alert would never recover
+	Recover *float64 `yaml:"recover" toml:"recover"`
+	// Number of consecutive intervals the threshold must be crossed before firing or recovering, 1 by default
+	For int `yaml:"for" toml:"for"`
+	// Severity of the alerts of the rule, "warning" by default
+	Severity string `yaml:"severity" toml:"severity"`
+}
+
+// rulesFile is the layout of the YAML or TOML rules file
+type rulesFile struct {
+	Rules []Rule `yaml:"rules" toml:"rules"`
+}
+
+// LoadRules reads the alert rules of a YAML or TOML file, depending on its extension
+//
+//	rules:
+//	  - name: server errors
+//	    metric: status
+//	    match: 5xx
+//	    window: 5m
+//	    threshold: 10
+//	    severity: critical
+//
+// or in TOML
+//
+//	[[rules]]
+//	name = "server errors"
+//	metric = "status"
+//	match = "5xx"
+//	window = "5m"
+//	threshold = 10.0
+//	severity = "critical"
+func LoadRules(path string) ([]Rule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file rulesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		if err := yaml.UnmarshalStrict(content, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), &file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown rules file extension, expected .yml, .yaml or .toml", path)
+	}
+	return file.Rules, nil
+}
+
+// ruleSample is what a rule keeps of each interval of its window
+type ruleSample struct {
+	// number of requests, or of bytes, matching the rule
+	count int
+	// number of requests of the interval
+	total int
+	// number of requests of each remote host, only kept by the host metric
+	hosts *TopK
+}
+
+// ruleState is a rule being evaluated by the monitor
+type ruleState struct {
+	Rule
+	// Value below which the rule recovers, Recover or Threshold
+	recoverAt float64
+	// Length of the window
+	window time.Duration
+	// Samples of the intervals of the window
+	samples []ruleSample
+	index   int
+	// Current alert status of the rule
+	inAlert bool
+	// Number of consecutive intervals the threshold has been crossed so far
+	pending int
+}
+
+// newRuleState checks a rule and prepares its evaluation with intervals of updateInterval seconds
+func newRuleState(rule Rule, updateInterval int) (*ruleState, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("alert rule without name")
+	}
+	switch rule.Metric {
+	case MetricRequests, MetricBytes, MetricHost:
+	case MetricStatus, MetricSection:
+		if rule.Match == "" {
+			return nil, fmt.Errorf("alert rule %q: the %s metric needs a match", rule.Name, rule.Metric)
+		}
+	default:
+		return nil, fmt.Errorf("alert rule %q: unknown metric %q", rule.Name, rule.Metric)
+	}
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return nil, fmt.Errorf("alert rule %q: invalid window: %v", rule.Name, err)
+	}
+	update := time.Duration(updateInterval) * time.Second
+	if window < update || window%update != 0 {
+		return nil, fmt.Errorf("alert rule %q: the window %v must be a multiple of the update interval %v", rule.Name, window, update)
+	}
+	recoverAt := rule.Threshold
+	if rule.Recover != nil && *rule.Recover == 0 {
+		return nil, fmt.Errorf("alert rule %q: recover must be above 0, or negative for the threshold, got 0", rule.Name)
+	}
+	if rule.Recover != nil && *rule.Recover > 0 {
+		recoverAt = *rule.Recover
+	}
+	if recoverAt > rule.Threshold {
+		return nil, fmt.Errorf("alert rule %q: the recover value %v is above the threshold %v", rule.Name, recoverAt, rule.Threshold)
+	}
+	if rule.For < 0 {
+		return nil, fmt.Errorf("alert rule %q: for must be a positive number of intervals", rule.Name)
+	}
+	if rule.For == 0 {
+		rule.For = 1
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	return &ruleState{
+		Rule:      rule,
+		recoverAt: recoverAt,
+		window:    window,
+		samples:   make([]ruleSample, window/update),
+	}, nil
+}
+
+// SetRules replaces the alert rules of the monitor
+// The rules are checked first, none is set if one of them is not valid
+func (m *LogMonitor) SetRules(rules []Rule) error {
+	states, err := newRuleStates(rules, m.UpdateInterval)
+	if err != nil {
+		return err
+	}
+	m.rules = states
+	return nil
+}
+
+// newRuleStates checks the rules and prepares their evaluation, the names of the rules must be unique
+func newRuleStates(rules []Rule, updateInterval int) ([]*ruleState, error) {
+	states := make([]*ruleState, 0, len(rules))
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		state, err := newRuleState(rule, updateInterval)
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("alert rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// rule returns the state of the rule with the given name, nil if there is none
+func (m *LogMonitor) rule(name string) *ruleState {
+	for _, rule := range m.rules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// add adds the counters of an interval to the window of the rule
+func (r *ruleState) add(stats *Aggregate) {
+	sample := ruleSample{total: stats.requests}
+	switch r.Metric {
+	case MetricRequests:
+		sample.count = stats.requests
+	case MetricBytes:
+		sample.count = stats.bytes
+	case MetricStatus:
+		sample.count = stats.status[r.Match]
+	case MetricSection:
+		sample.count = stats.sections[r.Match]
+	case MetricHost:
+		sample.hosts = stats.hosts
+	}
+	r.samples[r.index] = sample
+	r.index = (r.index + 1) % len(r.samples)
+}
+
+// value computes the metric of the rule over its window
+func (r *ruleState) value() float64 {
+	count, total := 0, 0
+	// The busiest host is estimated by merging the sketches of the intervals
+	// its count may be overestimated by at most the number of requests of the window divided by DefaultTopKCapacity
+	hosts := NewTopK(DefaultTopKCapacity)
+	for _, sample := range r.samples {
+		count += sample.count
+		total += sample.total
+		if sample.hosts != nil {
+			hosts.Merge(sample.hosts)
+		}
+	}
+	switch r.Metric {
+	case MetricStatus:
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(count) / float64(total)
+	case MetricHost:
+		busiest := 0
+		if top := hosts.Top(1); len(top) > 0 {
+			busiest = top[0].Value
+		}
+		return float64(busiest) / r.window.Minutes()
+	}
+	return float64(count) / r.window.Seconds()
+}
+
+// evaluateRules adds the counters of the closed interval to every rule
+// and sends an AlertRecord for each rule that fires or recovers
+func (m *LogMonitor) evaluateRules(stats *Aggregate) {
+	for _, rule := range m.rules {
+		rule.add(stats)
+		value := rule.value()
+		if !stateChange(rule.inAlert, value > rule.Threshold, value < rule.recoverAt, &rule.pending, rule.For) {
+			continue
+		}
+		rule.inAlert = !rule.inAlert
+		m.sendAlert(AlertRecord{
+			Alert:     rule.inAlert,
+			Time:      m.windowEnd,
+			Rule:      rule.Name,
+			Value:     value,
+			Threshold: rule.Threshold,
+			Severity:  rule.Severity,
+		})
+	}
+}
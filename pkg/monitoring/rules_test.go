@@ -0,0 +1,186 @@
+package monitoring
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// value returns a pointer to v, for the optional fields of the rules
+func value(v float64) *float64 {
+	return &v
+}
+
+func TestLoadRules(t *testing.T) {
+	content := `rules:
+  - name: server errors
+    metric: status
+    match: 5xx
+    window: 5m
+    threshold: 10
+    recover: 5
+    for: 2
+    severity: critical
+  - name: busy host
+    metric: host
+    window: 1m
+    threshold: 600
+`
+	if err := ioutil.WriteFile("rules.yml", []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("rules.yml")
+
+	got, err := LoadRules("rules.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Name: "server errors", Metric: MetricStatus, Match: "5xx", Window: "5m", Threshold: 10, Recover: value(5), For: 2, Severity: "critical"},
+		{Name: "busy host", Metric: MetricHost, Window: "1m", Threshold: 600},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadRules() = %v, want %v", got, want)
+	}
+
+	// Unknown keys are reported
+	if err := ioutil.WriteFile("rules.yml", []byte("rules:\n  - name: a\n    treshold: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules("rules.yml"); err == nil || !strings.Contains(err.Error(), "treshold") {
+		t.Errorf("LoadRules() err = %v, want an error about treshold", err)
+	}
+
+	// The TOML files are chosen by their extension
+	content = `[[rules]]
+name = "server errors"
+metric = "status"
+match = "5xx"
+window = "5m"
+threshold = 10.0
+recover = 5.0
+for = 2
+severity = "critical"
+
+[[rules]]
+name = "busy host"
+metric = "host"
+window = "1m"
+threshold = 600.0
+`
+	if err := ioutil.WriteFile("rules.toml", []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("rules.toml")
+	got, err = LoadRules("rules.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadRules() = %v, want %v", got, want)
+	}
+	if err := ioutil.WriteFile("rules.toml", []byte("[[rules]]\nname = \"a\"\ntreshold = 1.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules("rules.toml"); err == nil || !strings.Contains(err.Error(), "treshold") {
+		t.Errorf("LoadRules() err = %v, want an error about treshold", err)
+	}
+
+	// Other extensions are rejected
+	if err := ioutil.WriteFile("rules.json", []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("rules.json")
+	if _, err := LoadRules("rules.json"); err == nil || !strings.Contains(err.Error(), "extension") {
+		t.Errorf("LoadRules() err = %v, want an error about the extension", err)
+	}
+}
+
+func TestLogMonitor_SetRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr string
+	}{
+		{"valid", []Rule{{Name: "a", Metric: MetricRequests, Window: "30s", Threshold: 1}}, ""},
+		{"no name", []Rule{{Metric: MetricRequests, Window: "30s"}}, "without name"},
+		{"unknown metric", []Rule{{Name: "a", Metric: "latency", Window: "30s"}}, "unknown metric"},
+		{"no match", []Rule{{Name: "a", Metric: MetricSection, Window: "30s"}}, "needs a match"},
+		{"bad window", []Rule{{Name: "a", Metric: MetricBytes, Window: "5 minutes"}}, "invalid window"},
+		{"window not a multiple", []Rule{{Name: "a", Metric: MetricBytes, Window: "15s"}}, "multiple"},
+		{"recover above threshold", []Rule{{Name: "a", Metric: MetricBytes, Window: "10s", Threshold: 1, Recover: value(2)}}, "recover"},
+		{"recover 0", []Rule{{Name: "a", Metric: MetricBytes, Window: "10s", Threshold: 1, Recover: value(0)}}, "recover must be above 0"},
+		{"negative recover", []Rule{{Name: "a", Metric: MetricBytes, Window: "10s", Threshold: 1, Recover: value(-1)}}, ""},
+		{"negative for", []Rule{{Name: "a", Metric: MetricBytes, Window: "10s", For: -1}}, "positive"},
+		{"twice", []Rule{{Name: "a", Metric: MetricBytes, Window: "10s"}, {Name: "a", Metric: MetricHost, Window: "10s"}}, "twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := newMonitor(t, context.Background(), nil, Config{TimeWindow: 30, UpdateInterval: 10, Threshold: 10}, nil, nil)
+			err := monitor.SetRules(tt.rules)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("SetRules() err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Checks the value of each metric and that the rules fire and recover with hysteresis
+func TestLogMonitor_evaluateRules(t *testing.T) {
+	record := func(host string, section string, status string, bytes int) LogRecord {
+		return LogRecord{remotehost: host, section: section, status: status, bytesCount: bytes}
+	}
+	// Intervals of 10 seconds
+	intervals := [][]LogRecord{
+		{record("a", "/api", "200", 100), record("a", "/api", "500", 100), record("b", "/home", "200", 100)},
+		{record("a", "/api", "503", 1000), record("a", "/api", "502", 1000)},
+		{record("b", "/home", "200", 100), record("b", "/home", "200", 100)},
+		{record("b", "/home", "200", 100), record("c", "/home", "200", 100)},
+	}
+	tests := []struct {
+		name string
+		rule Rule
+		// alert state after each interval
+		want []bool
+	}{
+		// 33%, 60%, 50% then 0% of 5xx over 20s, recover below 40%
+		{"status", Rule{Name: "5xx", Metric: MetricStatus, Match: "5xx", Window: "20s", Threshold: 50, Recover: value(40)}, []bool{false, true, true, false}},
+		// 0.2, 0.2, 0, 0 req/s on /api over 10s
+		{"section", Rule{Name: "api", Metric: MetricSection, Match: "/api", Window: "10s", Threshold: 0.1}, []bool{true, true, false, false}},
+		// 30, 200, 20 then 20 B/s over 10s
+		{"bytes", Rule{Name: "bytes", Metric: MetricBytes, Window: "10s", Threshold: 150}, []bool{false, true, false, false}},
+		// busiest host: a with 6, a with 12, a or b with 6 then b with 9 req/min over 20s
+		{"host", Rule{Name: "host", Metric: MetricHost, Window: "20s", Threshold: 8}, []bool{false, true, false, true}},
+		// 0.3, 0.2, 0.2, 0.2 req/s over 10s
+		{"requests", Rule{Name: "requests", Metric: MetricRequests, Window: "10s", Threshold: 0.25, Recover: value(0.1)}, []bool{true, true, true, true}},
+		// 5xx above 50% during two intervals, then below 40% during two intervals
+		{"status for", Rule{Name: "5xx", Metric: MetricStatus, Match: "5xx", Window: "20s", Threshold: 45, Recover: value(40), For: 2}, []bool{false, false, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alertChan := make(chan AlertRecord, 10)
+			monitor := newMonitor(t, context.Background(), nil, Config{TimeWindow: 30, UpdateInterval: 10, Threshold: 10}, nil, alertChan)
+			if err := monitor.SetRules([]Rule{tt.rule}); err != nil {
+				t.Fatal(err)
+			}
+			inAlert := false
+			for i, records := range intervals {
+				monitor.evaluateRules(aggregateOf(records))
+				select {
+				case alert := <-alertChan:
+					if alert.Rule != tt.rule.Name || alert.Alert == inAlert || alert.Severity != "warning" {
+						t.Errorf("interval %d: unexpected alert %v", i, alert)
+					}
+					inAlert = alert.Alert
+				default:
+				}
+				if inAlert != tt.want[i] {
+					t.Errorf("interval %d: alert state %v, want %v", i, inAlert, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package monitoring
+
+import (
+	"bufio"
+	"context"
+	"github.com/hpcloud/tail"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// StdinName is the log file name reading the standard input
+const StdinName = "-"
+
+// Line is a line read from a LineSource
+type Line struct {
+	Text string
+	// Position of the log file after the line, zero for the sources that are not files
+	Position FileState
+}
+
+// LineSource produces the lines of a log, each source is read by the monitor in its own goroutine
+type LineSource interface {
+	// Name identifies the source in the statistics
+	Name() string
+	// Read passes each line to handle until handle returns false, ctx is cancelled or the source ends
+	Read(ctx context.Context, handle func(Line) bool) error
+}
+
+// NewSource returns the LineSource reading the log file at path
+// A file is followed from start, the standard input (StdinName) and the named pipes are read as streams
+// With reopen, a file moved or deleted is replaced by the next file created at the same path
+func NewSource(path string, start FileState, reopen bool) LineSource {
+	if path == StdinName {
+		return &streamSource{name: path, open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(os.Stdin), nil
+		}}
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		// Opening a named pipe waits for a writer, it is opened again once the writer closes it
+		return &streamSource{name: path, again: true, open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}}
+	}
+	return &fileSource{path: path, start: start, reopen: reopen}
+}
+
+// fileSource follows a log file like tail -f
+type fileSource struct {
+	path string
+	// where the reading starts
+	start FileState
+	// follow the next file created at the same path once the file is moved or deleted
+	reopen bool
+}
+
+// Name returns the path of the file
+func (s *fileSource) Name() string {
+	return s.path
+}
+
+// Read follows the file until ctx is cancelled
+func (s *fileSource) Read(ctx context.Context, handle func(Line) bool) error {
+	position := s.start
+	for {
+		moved, err := s.tail(ctx, &position, handle)
+		if err != nil || !moved {
+			return err
+		}
+		// The tailer may stop on an event of a previous file at the same path, the file is then still there
+		if current, _, err := currentFile(s.path); err == nil && current.Device == position.Device && current.Inode == position.Inode {
+			continue
+		}
+		if !s.reopen || !waitFile(ctx, s.path) {
+			return nil
+		}
+		// The new file is read from its beginning
+		if position, _, err = currentFile(s.path); err != nil {
+			return err
+		}
+	}
+}
+
+// tail follows the file from position until ctx is cancelled, handle returns false or the file is moved or deleted
+// position is updated with each line read, it returns true if the file has been moved or deleted
+func (s *fileSource) tail(ctx context.Context, position *FileState, handle func(Line) bool) (bool, error) {
+	// To continuously read the log file, we use the package tail (github.com/hpcloud/tail) that mimicks the fail -f behavior
+	// this package also manages file truncation which is nice, the rotations are handled by Read to know
+	// which file is read
+	config := tail.Config{Follow: true, MustExist: true, Logger: tail.DiscardingLogger}
+	if position.Offset > 0 {
+		config.Location = &tail.SeekInfo{Offset: position.Offset, Whence: io.SeekStart}
+	}
+	tailListener, err := tail.TailFile(s.path, config)
+	if err != nil {
+		return false, err
+	}
+	defer tailListener.Cleanup()
+	// Stop the tailer when ctx is cancelled, it closes its Lines channel once stopped
+	// Stop is not used as it waits for the tailer, which may be blocked sending a line
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			tailListener.Kill(nil)
+		case <-stopped:
+		}
+	}()
+	// The tailer reopens a truncated file without telling, the lines then start again from the beginning of the file
+	// A truncation is detected when a line ends past the size of the file, the size is only checked then
+	var size int64
+	for line := range tailListener.Lines {
+		position.Offset += int64(len(line.Text)) + 1
+		if position.Offset > size {
+			size = s.truncated(position, int64(len(line.Text))+1)
+		}
+		if !handle(Line{Text: line.Text, Position: *position}) {
+			// Let the tailer stop without waiting for it
+			go func() {
+				for range tailListener.Lines {
+				}
+			}()
+			return false, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return false, nil
+	}
+	if err := tailListener.Err(); err != nil {
+		return false, err
+	}
+	// The tailer stops by itself once the file has been moved or deleted
+	return true, nil
+}
+
+// truncated checks whether the file at the path has been truncated before the line of length n ending at position
+// The offset of a truncated file is reset to the end of the line, the first one read again
+// It returns the size of the file, the check is skipped if the path is now another file
+func (s *fileSource) truncated(position *FileState, n int64) int64 {
+	current, info, err := currentFile(s.path)
+	if err != nil || current.Device != position.Device || current.Inode != position.Inode {
+		return position.Offset
+	}
+	if info.Size() < position.Offset {
+		position.Offset = n
+	}
+	return info.Size()
+}
+
+// waitFile waits for a file to be created at path
+// It returns false if ctx is cancelled in the meantime
+func waitFile(ctx context.Context, path string) bool {
+	ticker := time.NewTicker(reopenPoll)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// streamSource reads the lines of a stream that cannot be followed like a file, the standard input or a named pipe
+type streamSource struct {
+	name string
+	// open opens the stream
+	open func() (io.ReadCloser, error)
+	// again tells whether the stream is opened again at its end
+	again bool
+}
+
+// Name returns the name of the stream
+func (s *streamSource) Name() string {
+	return s.name
+}
+
+// Read reads the stream until its end or until ctx is cancelled
+func (s *streamSource) Read(ctx context.Context, handle func(Line) bool) error {
+	lines := make(chan string)
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	// A read on a pipe cannot be cancelled, so the stream is read in its own goroutine
+	// Once the source is stopped, this goroutine only ends with the next line or the end of the stream
+	go func() {
+		errc <- s.scan(lines, done)
+	}()
+	for {
+		select {
+		case line := <-lines:
+			if !handle(Line{Text: line}) {
+				return nil
+			}
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// scan sends the lines of the stream to lines until its end or until done is closed
+func (s *streamSource) scan(lines chan<- string, done <-chan struct{}) error {
+	for {
+		reader, err := s.open()
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				reader.Close()
+				return nil
+			}
+		}
+		reader.Close()
+		if err := scanner.Err(); err != nil || !s.again {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package monitoring
+
+import (
+	"context"
+	"github.com/Baumanar/log-monitor/pkg/generator"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stringSource returns a stream source reading text, opened count times
+func stringSource(name string, text string, count int) *streamSource {
+	opened := 0
+	return &streamSource{name: name, again: count > 1, open: func() (io.ReadCloser, error) {
+		opened++
+		if opened > count {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return ioutil.NopCloser(strings.NewReader(text)), nil
+	}}
+}
+
+// Checks that a stream is read line by line until its end, or until handle stops the reading
+func TestStreamSource_Read(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  *streamSource
+		stop    int
+		want    []string
+		wantErr bool
+	}{
+		{"test0", stringSource("-", "a\nb\nc\n", 1), 0, []string{"a", "b", "c"}, false},
+		{"test1", stringSource("-", "a\nb\nc", 1), 0, []string{"a", "b", "c"}, false},
+		{"test2", stringSource("-", "a\nb\nc\n", 1), 2, []string{"a", "b"}, false},
+		// A named pipe is opened again once its writer closes it
+		{"test3", stringSource("pipe", "a\nb\n", 2), 0, []string{"a", "b", "a", "b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := tt.source.Read(context.Background(), func(line Line) bool {
+				got = append(got, line.Text)
+				return len(got) != tt.stop
+			})
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Read() got %v, want %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Read() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Checks that a stream waiting for a line stops when the context is cancelled
+func TestStreamSource_cancel(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	source := &streamSource{name: "-", open: func() (io.ReadCloser, error) {
+		return reader, nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- source.Read(ctx, func(Line) bool { return true })
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Read() err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Read() did not stop once cancelled")
+	}
+}
+
+// Checks that the lines of the Sources are counted besides the log files, broken down by source
+func TestLogMonitor_readLogSources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := newMonitor(t, ctx, cancel, Config{TimeWindow: 10, UpdateInterval: 5, Threshold: 10}, make(chan StatRecord), make(chan AlertRecord))
+	line := generator.GenerateLog()
+	monitor.Sources = []LineSource{
+		stringSource("first", strings.Repeat(line, 3), 1),
+		stringSource("second", strings.Repeat(line, 4)+"malformed\n", 1),
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	readAll(monitor)
+
+	total, bySource := pendingRequests(monitor)
+	if total != 7 || bySource["first"] != 3 || bySource["second"] != 4 {
+		t.Errorf("ReadLog() read %d lines, %v by source", total, bySource)
+	}
+	if monitor.ParseErrors != 1 {
+		t.Errorf("ParseErrors = %d, want 1", monitor.ParseErrors)
+	}
+	if len(monitor.positions) != 0 {
+		t.Errorf("the sources should have no position: %v", monitor.positions)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package monitoring
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Checks that a named pipe is read as a stream and opened again for each writer
+func TestNewSource_namedPipe(t *testing.T) {
+	path := filepath.Join(tempDir(t), "access.pipe")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := NewSource(path, FileState{}, false)
+	if _, ok := source.(*streamSource); !ok {
+		t.Fatalf("NewSource() = %T, want a stream source", source)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	go source.Read(ctx, func(line Line) bool {
+		lines <- line.Text
+		return true
+	})
+	// Two writers one after the other
+	for _, text := range []string{"first\n", "second\n"} {
+		writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.WriteString(text)
+		writer.Close()
+		select {
+		case line := <-lines:
+			if line+"\n" != text {
+				t.Errorf("Read() got %q, want %q", line, text)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Read() did not read %q", text)
+		}
+	}
+}
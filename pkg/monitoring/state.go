@@ -0,0 +1,170 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileState identifies a log file and gives the offset after the last line counted by the monitor
+// Device and Inode are zero on the platforms that do not provide them
+type FileState struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// State is the state of the monitor saved to the StateFile
+// A restarted monitor resumes the reading of each file where it stopped and keeps its alerting window
+type State struct {
+	Files map[string]FileState `json:"files"`
+	// Alerting window of the high traffic alert, only restored if its size is unchanged
+	AlertTraffic   []int   `json:"alert_traffic"`
+	AlertIntervals []int64 `json:"alert_intervals"`
+	// Alerts active when the state was saved, the high traffic alert has an empty Rule
+	Alerts []AlertRecord `json:"alerts,omitempty"`
+}
+
+// LoadState reads a state saved by SaveState
+// A missing file gives an empty state, the log files are then read from their beginning
+func LoadState(path string) (*State, error) {
+	state := &State{Files: make(map[string]FileState)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]FileState)
+	}
+	return state, nil
+}
+
+// SaveState writes the state to path
+// The file is replaced atomically so a crash while saving does not lose the previous state
+func SaveState(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// currentFile returns the identity of the file found at path, with a zero offset
+func currentFile(path string) (FileState, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileState{}, nil, err
+	}
+	device, inode := fileIdentity(info)
+	return FileState{Device: device, Inode: inode}, info, nil
+}
+
+// resumeFile returns where the reading of the file at path starts
+// The saved offset is kept if the file is still the same one and it has not been truncated,
+// otherwise the file has been rotated or truncated since and it is read from its beginning
+func resumeFile(path string, saved FileState, ok bool) FileState {
+	current, info, err := currentFile(path)
+	if err != nil || !ok {
+		return current
+	}
+	if current.Device == saved.Device && current.Inode == saved.Inode && info.Size() >= saved.Offset {
+		current.Offset = saved.Offset
+	}
+	return current
+}
+
+// loadState restores the State saved in the StateFile, if any
+// It is called after Start as the alerting window is restored relative to the first interval to report
+func (m *LogMonitor) loadState() error {
+	m.resume = make(map[string]FileState)
+	if m.StateFile == "" {
+		return nil
+	}
+	state, err := LoadState(m.StateFile)
+	if err != nil {
+		return err
+	}
+	// The positions of the files no longer monitored are kept for a later start
+	for logFile, saved := range state.Files {
+		m.resume[logFile] = saved
+	}
+	for _, logFile := range m.LogFiles {
+		// The standard input has no position
+		if logFile == StdinName {
+			continue
+		}
+		saved, ok := state.Files[logFile]
+		m.resume[logFile] = resumeFile(logFile, saved, ok)
+	}
+	// Only the intervals still in the window are restored
+	if len(state.AlertTraffic) == len(m.AlertTraffic) && len(state.AlertIntervals) == len(m.AlertIntervals) {
+		for i, n := range state.AlertIntervals {
+			if n > m.next-int64(len(m.AlertTraffic)) {
+				m.AlertTraffic[i] = state.AlertTraffic[i]
+				m.AlertIntervals[i] = n
+			}
+		}
+	}
+	// The active alerts are sent again so that the sinks know they are still active
+	for _, alert := range state.Alerts {
+		if alert.Rule == "" {
+			m.InAlert = true
+		} else if rule := m.rule(alert.Rule); rule != nil {
+			rule.inAlert = true
+		} else {
+			// The rule has been removed since
+			continue
+		}
+		alert.Resumed = true
+		m.sendAlert(alert)
+	}
+	return nil
+}
+
+// saveState writes the State of the monitor to the StateFile, if any
+// The saved positions are the ones of the last lines reported, a line is never counted twice nor skipped after a restart
+func (m *LogMonitor) saveState() {
+	if m.StateFile == "" {
+		return
+	}
+	state := &State{
+		Files:          make(map[string]FileState, len(m.resume)),
+		AlertTraffic:   m.AlertTraffic,
+		AlertIntervals: m.AlertIntervals,
+	}
+	for logFile, position := range m.resume {
+		state.Files[logFile] = position
+	}
+	for logFile, position := range m.positions {
+		state.Files[logFile] = position
+	}
+	for _, alert := range m.active {
+		state.Alerts = append(state.Alerts, alert)
+	}
+	sort.Slice(state.Alerts, func(i, j int) bool {
+		return state.Alerts[i].Rule < state.Alerts[j].Rule
+	})
+	if err := SaveState(m.StateFile, state); err != nil {
+		m.abort(err)
+	}
+}
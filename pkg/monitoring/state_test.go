@@ -0,0 +1,365 @@
+package monitoring
+
+import (
+	"context"
+	"github.com/Baumanar/log-monitor/pkg/generator"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tempDir creates a temporary directory removed at the end of the test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// writeLines appends n log lines to path, the file is created if needed
+func writeLines(path string, n int) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file.Close()
+	for i := 0; i < n; i++ {
+		generator.WriteLogLine(path)
+	}
+}
+
+// Checks that the saved state is loaded back and that a missing file gives an empty state
+func TestSaveState(t *testing.T) {
+	path := filepath.Join(tempDir(t), "state.json")
+
+	state, err := LoadState(path)
+	if err != nil || len(state.Files) != 0 || state.Alerts != nil {
+		t.Fatalf("LoadState() = %v, %v, want an empty state", state, err)
+	}
+	want := &State{
+		Files:          map[string]FileState{"/var/log/a.log": {Device: 2049, Inode: 12, Offset: 1234}},
+		AlertTraffic:   []int{3, 4},
+		AlertIntervals: []int64{10, 11},
+		Alerts:         []AlertRecord{{Alert: true, NumTraffic: 7, Time: time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)}},
+	}
+	if err := SaveState(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadState(path)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadState() = %v, %v, want %v", got, err, want)
+	}
+}
+
+// Checks that the saved offset is only kept if the file has not been rotated or truncated
+func Test_resumeFile(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current, _, err := currentFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another file with a different inode
+	other := filepath.Join(dir, "other.log")
+	if err := ioutil.WriteFile(other, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _, err := currentFile(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		saved FileState
+		ok    bool
+		want  int64
+	}{
+		{"test0", FileState{}, false, 0},
+		{"test1", FileState{Device: current.Device, Inode: current.Inode, Offset: 4}, true, 4},
+		{"test2", FileState{Device: current.Device, Inode: current.Inode, Offset: 10}, true, 10},
+		{"test3", FileState{Device: current.Device, Inode: current.Inode, Offset: 11}, true, 0},
+		{"test4", FileState{Device: rotated.Device, Inode: rotated.Inode, Offset: 4}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resumeFile(path, tt.saved, tt.ok)
+			if got.Offset != tt.want || got.Inode != current.Inode || got.Device != current.Device {
+				t.Errorf("resumeFile() = %v, want offset %d of %v", got, tt.want, current)
+			}
+		})
+	}
+}
+
+// runOnce reads the log file until cancelled after a short time, then reports every interval and saves the state
+// It returns the number of requests reported
+func runOnce(t *testing.T, logFile string, stateFile string) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statChan := make(chan StatRecord, 100)
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{logFile}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10, ReOpenFile: true}, statChan, make(chan AlertRecord, 10))
+	monitor.StateFile = stateFile
+	monitor.Start(time.Now())
+	if err := monitor.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	readAll(monitor)
+	monitor.flush(time.Now())
+	monitor.saveState()
+	close(statChan)
+	requests := 0
+	for stat := range statChan {
+		requests += stat.NumRequests
+	}
+	return requests
+}
+
+// Checks that a restarted monitor only counts the lines written after it stopped, across rotations and truncations
+func TestLogMonitor_resume(t *testing.T) {
+	dir := tempDir(t)
+	logFile := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "state.json")
+	if _, err := os.Create(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// change done to the log file while the monitor is stopped
+		change  func()
+		written int
+	}{
+		{"test0", func() {}, 20},
+		{"test1", func() {}, 35},
+		{"test2", func() {}, 0},
+		{"test3", func() { os.Rename(logFile, logFile+".1") }, 12},
+		{"test4", func() { os.Truncate(logFile, 0) }, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			writeLines(logFile, tt.written)
+			if got := runOnce(t, logFile, stateFile); got != tt.written {
+				t.Errorf("the monitor counted %d lines, want %d", got, tt.written)
+			}
+		})
+	}
+}
+
+// Checks that the saved position stops before the lines of the intervals still open
+func TestLogMonitor_checkpoint(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	monitor := newMonitor(t, context.Background(), nil, Config{LogFiles: []string{"a.log", "b.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 10}, make(chan StatRecord, 10), make(chan AlertRecord, 10))
+	monitor.Start(start)
+	handle := func(source string, second int, offset int64) {
+		monitor.handle(&LogRecord{source: source, date: start.Add(time.Duration(second) * time.Second), position: FileState{Offset: offset}})
+	}
+	// a.log has a line of the second interval between two lines of the first one
+	handle("a.log", 1, 10)
+	handle("a.log", 12, 20)
+	handle("a.log", 3, 30)
+	handle("b.log", 2, 10)
+	handle("b.log", 4, 20)
+
+	tests := []struct {
+		name  string
+		until time.Duration
+		want  map[string]int64
+	}{
+		{"test0", 9 * time.Second, map[string]int64{}},
+		{"test1", 10 * time.Second, map[string]int64{"a.log": 10, "b.log": 20}},
+		{"test2", 20 * time.Second, map[string]int64{"a.log": 30, "b.log": 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor.CloseIntervals(start.Add(tt.until))
+			got := make(map[string]int64)
+			for logFile, position := range monitor.positions {
+				got[logFile] = position.Offset
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// A late line of a closed interval is saved with the next interval
+	handle("b.log", 5, 30)
+	monitor.CloseIntervals(start.Add(30 * time.Second))
+	if got := monitor.positions["b.log"].Offset; got != 30 {
+		t.Errorf("position of b.log = %d, want 30", got)
+	}
+}
+
+// Checks that a monitor stopped without reporting its open interval, as after a crash, reads its lines again
+func TestLogMonitor_resumeOpenInterval(t *testing.T) {
+	dir := tempDir(t)
+	logFile := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "state.json")
+	writeLines(logFile, 10)
+
+	// The lines are read but their interval is still open when the state is saved
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{logFile}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10, StateFile: stateFile, Lateness: time.Hour}, make(chan StatRecord, 10), make(chan AlertRecord, 10))
+	monitor.Start(time.Now())
+	if err := monitor.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	readAll(monitor)
+	monitor.CloseIntervals(time.Now().Add(-monitor.Lateness))
+	monitor.saveState()
+
+	if got := runOnce(t, logFile, stateFile); got != 10 {
+		t.Errorf("the restarted monitor counted %d lines, want 10", got)
+	}
+}
+
+// Checks that a file rotated while it is read is replaced by the new file at the same path
+func TestLogMonitor_readLogRotation(t *testing.T) {
+	dir := tempDir(t)
+	logFile := filepath.Join(dir, "access.log")
+	writeLines(logFile, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{logFile}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10, ReOpenFile: true}, make(chan StatRecord, 10), make(chan AlertRecord, 10))
+	monitor.Start(time.Now())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		os.Rename(logFile, logFile+".1")
+		writeLines(logFile, 5)
+		time.Sleep(time.Second)
+		cancel()
+	}()
+	readAll(monitor)
+
+	if got, _ := pendingRequests(monitor); got != 15 {
+		t.Errorf("ReadLog() read %d lines, want 15", got)
+	}
+	// The position is saved once the lines are reported
+	monitor.flush(time.Now())
+	current, info, err := currentFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := monitor.positions[logFile]; position.Inode != current.Inode || position.Offset != info.Size() {
+		t.Errorf("the position is %v, want the end of %v", position, current)
+	}
+}
+
+// Checks that the position is reset when the file is truncated while it is read
+func TestLogMonitor_readLogTruncation(t *testing.T) {
+	dir := tempDir(t)
+	logFile := filepath.Join(dir, "access.log")
+	writeLines(logFile, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{logFile}, TimeWindow: 10, UpdateInterval: 5, Threshold: 10, ReOpenFile: true}, make(chan StatRecord, 10), make(chan AlertRecord, 10))
+	monitor.Start(time.Now())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		os.Truncate(logFile, 0)
+		time.Sleep(200 * time.Millisecond)
+		writeLines(logFile, 3)
+		time.Sleep(time.Second)
+		cancel()
+	}()
+	readAll(monitor)
+
+	if got, _ := pendingRequests(monitor); got != 13 {
+		t.Errorf("ReadLog() read %d lines, want 13", got)
+	}
+	// The position is saved once the lines are reported
+	monitor.flush(time.Now())
+	current, info, err := currentFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := monitor.positions[logFile]; position.Inode != current.Inode || position.Offset != info.Size() {
+		t.Errorf("the position is %v, want the end of %v", position, info.Size())
+	}
+}
+
+// Checks that the alerting window and the active alerts are carried over to the next start
+func TestLogMonitor_loadState(t *testing.T) {
+	stateFile := filepath.Join(tempDir(t), "state.json")
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+
+	monitorWith := func(ctx context.Context, cancel context.CancelFunc, alertChan chan AlertRecord) *LogMonitor {
+		monitor := newMonitor(t, ctx, cancel, Config{LogFiles: []string{"test.log"}, TimeWindow: 30, UpdateInterval: 10, Threshold: 1}, make(chan StatRecord, 10), alertChan)
+		monitor.StateFile = stateFile
+		if err := monitor.SetRules([]Rule{{Name: "api", Metric: MetricRequests, Window: "10s", Threshold: 1, Recover: value(1)}}); err != nil {
+			t.Fatal(err)
+		}
+		return monitor
+	}
+
+	// The first monitor fires both alerts, then stops during its third interval
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := monitorWith(ctx, cancel, make(chan AlertRecord, 10))
+	first.Start(start)
+	for i := 0; i < 50; i++ {
+		record := LogRecord{date: start.Add(time.Duration(i%25) * time.Second), section: "/a", method: "GET", status: "200"}
+		first.add(&record)
+	}
+	first.flush(start.Add(25 * time.Second))
+	first.saveState()
+	if !first.InAlert || len(first.active) != 2 {
+		t.Fatalf("the first monitor should be in alert, active alerts: %v", first.active)
+	}
+
+	// The second monitor starts 3 seconds later, during the same interval
+	alertChan := make(chan AlertRecord, 10)
+	second := monitorWith(ctx, cancel, alertChan)
+	second.Start(start.Add(28 * time.Second))
+	if err := second.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second.AlertTraffic, first.AlertTraffic) || second.windowTraffic() != 50 {
+		t.Errorf("AlertTraffic = %v, want %v", second.AlertTraffic, first.AlertTraffic)
+	}
+	if !second.InAlert || !second.rules[0].inAlert {
+		t.Errorf("the alerts should still be active")
+	}
+	for i := 0; i < 2; i++ {
+		if alert := <-alertChan; !alert.Alert || !alert.Resumed {
+			t.Errorf("got alert %v, want a resumed alert", alert)
+		}
+	}
+	// The rest of the interval is added to the traffic counted before the restart
+	record := LogRecord{date: start.Add(29 * time.Second), section: "/a", method: "GET", status: "200"}
+	second.add(&record)
+	second.CloseIntervals(start.Add(30 * time.Second))
+	if traffic := second.windowTraffic(); traffic != 51 {
+		t.Errorf("windowTraffic() = %d, want 51", traffic)
+	}
+
+	// A monitor starting once the window has passed does not keep the old traffic
+	late := monitorWith(ctx, cancel, make(chan AlertRecord, 10))
+	late.Start(start.Add(time.Hour))
+	if err := late.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if traffic := late.windowTraffic(); traffic != 0 {
+		t.Errorf("windowTraffic() = %d, want 0", traffic)
+	}
+}
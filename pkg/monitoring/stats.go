@@ -3,17 +3,52 @@ package monitoring
 import (
 	"fmt"
 	"sort"
+	"time"
 )
 
 // StatRecord is the type passed from the Monitor to
 // the display when there is an update
 type StatRecord struct {
-	TopSections []Pair
-	TopMethods  []Pair
-	TopStatus   []Pair
-	NumRequests int
+	// Start of the interval, the records are assigned to intervals according to their date
+	Time        time.Time `json:"time"`
+	TopSections []Pair    `json:"top_sections"`
+	TopMethods  []Pair    `json:"top_methods"`
+	TopStatus   []Pair    `json:"top_status"`
+	// Remote hosts and authenticated users sending the most requests
+	TopHosts    []Pair `json:"top_hosts"`
+	TopUsers    []Pair `json:"top_users"`
+	NumRequests int    `json:"requests"`
 	// the number of byte send will already be formatted
-	BytesCount string
+	BytesCount string `json:"bytes"`
+	// Number of lines that could not be parsed during the interval
+	ParseErrors int `json:"parse_errors"`
+	// Hits of every section/method/status class of the interval, the top lists are taken from them
+	Sections map[string]int `json:"sections,omitempty"`
+	Methods  map[string]int `json:"methods,omitempty"`
+	Status   map[string]int `json:"status,omitempty"`
+	// Number of bytes transferred, not formatted
+	NumBytes int `json:"num_bytes"`
+	// Number of requests in the alerting window once the interval has been added to it
+	WindowTraffic int `json:"window_traffic"`
+	// Partial is true if the interval had not ended when the monitor stopped
+	Partial bool `json:"partial,omitempty"`
+	// Statistics of each log file, only set when several files are monitored
+	Sources map[string]StatRecord `json:"sources,omitempty"`
+	// Latency of the requests, nil if the log format has no request duration
+	Latency *Latency `json:"latency,omitempty"`
+	// Latency of the requests of each top section
+	SectionLatency map[string]Latency `json:"section_latency,omitempty"`
+}
+
+// Latency gives the percentiles of the durations of the requests
+// The durations are encoded in nanoseconds in JSON
+type Latency struct {
+	// Number of requests with a duration
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
 }
 
 // AlertRecord is the type passed from the Monitor to
@@ -21,46 +56,40 @@ type StatRecord struct {
 // if Alert is true, the threshold has been exceeded
 // if Alert in false, the Alert recovered
 // NumTraffic is the current number of request in the timeWindow (2min default)
+// Time is the date of the logs at which the alert was triggered or recovered
+// Rule is empty for the high traffic alert, otherwise it is the name of the alert rule
+// and Value is the value of its metric
+// Resumed is true if the alert was already active before the monitor restarted, it has been notified then
+// Reload is not empty if the record is not an alert but a reload of the settings, it describes the changes
 type AlertRecord struct {
-	Alert      bool
-	NumTraffic int
+	Alert      bool      `json:"alert"`
+	NumTraffic int       `json:"traffic"`
+	Time       time.Time `json:"time"`
+	Rule       string    `json:"rule,omitempty"`
+	Value      float64   `json:"value,omitempty"`
+	Threshold  float64   `json:"threshold,omitempty"`
+	Severity   string    `json:"severity,omitempty"`
+	Resumed    bool      `json:"resumed,omitempty"`
+	Reload     string    `json:"reload,omitempty"`
 }
 
 // Pair is composed by a Key and a Value
 // Key is the name of the section/method/status
 // Value is the number of hits
 type Pair struct {
-	Key   string
-	Value int
+	Key   string `json:"key"`
+	Value int    `json:"value"`
 }
 
 // GetStats computes the statistics from a list of LogRecords records
 // k is number of lines for each stat to display
-// Returns a statRecord with the top sections/HTTP methods/status, the number of requests and the number of bytes
+// Returns a statRecord with the top sections/HTTP methods/status/hosts/users, the number of requests and the number of bytes
 func GetStats(records []LogRecord, k int) StatRecord {
-
-	// Create maps to count the number of hits for sections, HTTP methods and status
-	// Get the number of requests during this step (10s default) and initialize a byte count
-	sectionMap := make(map[string]int, 0)
-	methodMap := make(map[string]int, 0)
-	statusMap := make(map[string]int, 0)
-	requests := len(records)
-	var bytesCount int
-
-	// update maps and byteCount with each record
-	for _, log := range records {
-		sectionMap[log.section]++
-		methodMap[log.method]++
-		statusMap[ProcessStatus(log.status)]++
-		bytesCount += log.bytesCount
-	}
-	return StatRecord{
-		TopSections: getTopK(sectionMap, k),
-		TopMethods:  getTopK(methodMap, k),
-		TopStatus:   getTopK(statusMap, k),
-		NumRequests: requests,
-		BytesCount:  FormatByteCount(bytesCount),
+	aggregate := NewAggregate()
+	for i := range records {
+		aggregate.Add(&records[i])
 	}
+	return aggregate.Stats(k)
 }
 
 // Min returns the min between to integers
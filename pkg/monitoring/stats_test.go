@@ -1,6 +1,9 @@
 package monitoring
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func Test_processStatus(t *testing.T) {
 	type args struct {
@@ -70,3 +73,28 @@ func Test_formatByteCount(t *testing.T) {
 		})
 	}
 }
+
+// Checks that the latency is reported for the interval and each top section, and only when durations are known
+func TestGetStats_latency(t *testing.T) {
+	var records []LogRecord
+	for i := 1; i <= 10; i++ {
+		records = append(records, LogRecord{section: "/api", duration: time.Duration(i) * time.Millisecond, timed: true})
+	}
+	records = append(records, LogRecord{section: "/home", duration: time.Second, timed: true})
+	records = append(records, LogRecord{section: "/cart"})
+
+	// The percentiles come from a histogram, they are within 1/64 of the exact ones
+	stat := GetStats(records, 5)
+	if stat.Latency == nil || !approxLatency(*stat.Latency, Latency{11, 6 * time.Millisecond, 10 * time.Millisecond, time.Second, time.Second}) {
+		t.Errorf("GetStats() latency = %v", stat.Latency)
+	}
+	if got := stat.SectionLatency["/api"]; !approxLatency(got, Latency{10, 5 * time.Millisecond, 9 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}) {
+		t.Errorf("GetStats() /api latency = %v", got)
+	}
+	if _, ok := stat.SectionLatency["/cart"]; ok || len(stat.SectionLatency) != 2 {
+		t.Errorf("GetStats() section latency = %v", stat.SectionLatency)
+	}
+	if stat := GetStats(records[11:], 5); stat.Latency != nil || stat.SectionLatency != nil {
+		t.Errorf("GetStats() without durations latency = %v, %v", stat.Latency, stat.SectionLatency)
+	}
+}
@@ -0,0 +1,162 @@
+package monitoring
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// DefaultTopKCapacity is the number of keys kept by the sketches of the statistics
+// Keys sending more than 1/DefaultTopKCapacity of the requests are always reported
+const DefaultTopKCapacity = 1000
+
+// TopK finds the most frequent keys of a stream with a bounded memory, using the Space-Saving algorithm
+// (Metwally, Agrawal and El Abbadi, "Efficient computation of frequent and top-k elements in data streams")
+// At most capacity keys are counted. When a new key arrives and the sketch is full, it replaces the key
+// with the lowest count and inherits its count, which is kept as the maximum error of the new key.
+// With N the sum of the counts:
+//   - a count is never underestimated and is overestimated by at most N/capacity
+//   - every key whose real count is above N/capacity is in the sketch
+//
+// The counts are exact as long as there are at most capacity distinct keys.
+type TopK struct {
+	capacity int
+	// total of the counts added
+	total int
+	// counters by key, and the same counters in a min-heap on their count
+	counters map[string]*topKCounter
+	heap     topKHeap
+}
+
+// topKCounter is the count of a key of a TopK
+type topKCounter struct {
+	key   string
+	count int
+	// maximum overestimation of count
+	err int
+	// position of the counter in the heap
+	index int
+}
+
+// NewTopK returns a TopK counting at most capacity keys
+func NewTopK(capacity int) *TopK {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TopK{
+		capacity: capacity,
+		counters: make(map[string]*topKCounter),
+	}
+}
+
+// Add adds count occurrences of key
+func (t *TopK) Add(key string, count int) {
+	t.add(key, count, 0)
+}
+
+// add adds count occurrences of key, whose count may already be overestimated by err
+func (t *TopK) add(key string, count int, err int) {
+	t.total += count
+	if counter, ok := t.counters[key]; ok {
+		counter.count += count
+		counter.err += err
+		heap.Fix(&t.heap, counter.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		counter := &topKCounter{key: key, count: count, err: err}
+		t.counters[key] = counter
+		heap.Push(&t.heap, counter)
+		return
+	}
+	// Replace the key with the lowest count
+	counter := t.heap[0]
+	delete(t.counters, counter.key)
+	counter.key = key
+	counter.err = counter.count + err
+	counter.count += count
+	t.counters[key] = counter
+	heap.Fix(&t.heap, 0)
+}
+
+// Merge adds the counts of other, the errors of both sketches add up
+func (t *TopK) Merge(other *TopK) {
+	for _, counter := range other.heap {
+		t.add(counter.key, counter.count, counter.err)
+	}
+}
+
+// Count returns the estimated count of key and its maximum overestimation
+// A key that is not in the sketch has a count of 0 and its real count is at most the lowest count of the sketch
+func (t *TopK) Count(key string) (count int, err int) {
+	if counter, ok := t.counters[key]; ok {
+		return counter.count, counter.err
+	}
+	return 0, t.minCount()
+}
+
+// minCount returns the lowest count of a full sketch, 0 otherwise
+func (t *TopK) minCount() int {
+	if len(t.heap) < t.capacity || len(t.heap) == 0 {
+		return 0
+	}
+	return t.heap[0].count
+}
+
+// Total returns the sum of the counts added
+func (t *TopK) Total() int {
+	return t.total
+}
+
+// Len returns the number of keys in the sketch
+func (t *TopK) Len() int {
+	return len(t.heap)
+}
+
+// Top returns the k keys with the highest counts, the first one has the highest count
+// Keys with the same count are sorted alphabetically
+func (t *TopK) Top(k int) []Pair {
+	pairs := make([]Pair, 0, len(t.heap))
+	for _, counter := range t.heap {
+		pairs = append(pairs, Pair{counter.key, counter.count})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Value != pairs[j].Value {
+			return pairs[i].Value > pairs[j].Value
+		}
+		return pairs[i].Key < pairs[j].Key
+	})
+	return pairs[:Min(k, len(pairs))]
+}
+
+// Reset removes all the keys of the sketch
+func (t *TopK) Reset() {
+	t.total = 0
+	t.counters = make(map[string]*topKCounter)
+	t.heap = t.heap[:0]
+}
+
+// topKHeap is a min-heap of counters implementing heap.Interface
+type topKHeap []*topKCounter
+
+func (h topKHeap) Len() int { return len(h) }
+
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	counter := x.(*topKCounter)
+	counter.index = len(*h)
+	*h = append(*h, counter)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	counter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return counter
+}
@@ -0,0 +1,156 @@
+package monitoring
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// zipfStream returns n keys drawn from a Zipf distribution over max keys, like the clients of a web server
+func zipfStream(n int, max uint64) []string {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(42)), 1.1, 1, max-1)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "10.0." + strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return keys
+}
+
+func TestTopK_exact(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		k     int
+		want  []Pair
+	}{
+		{"test0", nil, 3, []Pair{}},
+		{"test1", []string{"a", "b", "a", "c", "a", "b"}, 2, []Pair{{"a", 3}, {"b", 2}}},
+		{"test2", []string{"b", "a", "c"}, 5, []Pair{{"a", 1}, {"b", 1}, {"c", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topK := NewTopK(3)
+			for _, key := range tt.input {
+				topK.Add(key, 1)
+			}
+			if got := topK.Top(tt.k); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Top() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Checks the bounds of the Space-Saving algorithm on a skewed stream with many more keys than counters
+func TestTopK_accuracy(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		keys     uint64
+		capacity int
+	}{
+		{"test0", 100000, 100000, 100},
+		{"test1", 100000, 1000000, 1000},
+		{"test2", 50000, 500, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := zipfStream(tt.n, tt.keys)
+			exact := make(map[string]int)
+			topK := NewTopK(tt.capacity)
+			for _, key := range stream {
+				exact[key]++
+				topK.Add(key, 1)
+			}
+			if topK.Len() > tt.capacity || topK.Total() != tt.n {
+				t.Fatalf("sketch has %d keys and a total of %d", topK.Len(), topK.Total())
+			}
+			bound := tt.n / tt.capacity
+			// Every count is an overestimation within its error, itself below N/capacity
+			for _, pair := range topK.Top(tt.capacity) {
+				count, err := topK.Count(pair.Key)
+				if count < exact[pair.Key] || count-err > exact[pair.Key] || err > bound {
+					t.Errorf("%s counted %d with an error of %d, real count %d", pair.Key, count, err, exact[pair.Key])
+				}
+			}
+			// Every key above N/capacity is in the sketch
+			for key, count := range exact {
+				if estimate, _ := topK.Count(key); count > bound && estimate == 0 {
+					t.Errorf("%s with %d requests is missing", key, count)
+				}
+			}
+			// The top 5 is the real top 5
+			want := getTopK(exact, 5)
+			for i, pair := range topK.Top(5) {
+				if pair.Key != want[i].Key && exact[pair.Key] != want[i].Value {
+					t.Errorf("Top() %d = %v, want %v", i, pair, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTopK_Merge(t *testing.T) {
+	first, second := NewTopK(2), NewTopK(2)
+	first.Add("a", 5)
+	first.Add("b", 1)
+	second.Add("a", 2)
+	second.Add("c", 4)
+	first.Merge(second)
+	if got := first.Top(2); fmt.Sprint(got) != fmt.Sprint([]Pair{{"a", 7}, {"c", 5}}) {
+		t.Errorf("Merge() top = %v", got)
+	}
+	// c replaced b, its count is overestimated by the count of b
+	if count, err := first.Count("c"); count != 5 || err != 1 {
+		t.Errorf("Count(c) = %d, %d, want 5, 1", count, err)
+	}
+	if first.Total() != 12 {
+		t.Errorf("Total() = %d, want 12", first.Total())
+	}
+
+	// The error of a key already approximate in other is carried over
+	third := NewTopK(1)
+	third.Add("d", 3)
+	third.Add("a", 1)
+	first.Merge(third)
+	if count, err := first.Count("a"); count != 11 || err != 3 {
+		t.Errorf("Count(a) = %d, %d, want 11, 3", count, err)
+	}
+	// f replaces c, its error is the count of c plus its error in other
+	fourth := NewTopK(1)
+	fourth.Add("e", 2)
+	fourth.Add("f", 1)
+	first.Merge(fourth)
+	if count, err := first.Count("f"); count != 8 || err != 7 {
+		t.Errorf("Count(f) = %d, %d, want 8, 7", count, err)
+	}
+	first.Reset()
+	if first.Len() != 0 || first.Total() != 0 || len(first.Top(2)) != 0 {
+		t.Errorf("Reset() left %v", first.Top(2))
+	}
+}
+
+func BenchmarkTopK(b *testing.B) {
+	stream := zipfStream(100000, 1000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		topK := NewTopK(DefaultTopKCapacity)
+		for _, key := range stream {
+			topK.Add(key, 1)
+		}
+		topK.Top(5)
+	}
+}
+
+// BenchmarkGetTopK is the exact count with a map and a full sort, to compare with BenchmarkTopK
+func BenchmarkGetTopK(b *testing.B) {
+	stream := zipfStream(100000, 1000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counts := make(map[string]int)
+		for _, key := range stream {
+			counts[key]++
+		}
+		getTopK(counts, 5)
+	}
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// emailTimeout bounds the whole exchange with the SMTP server when the context has no deadline
+const emailTimeout = 30 * time.Second
+
+// Email is a Notifier sending each alert by email through an SMTP server
+type Email struct {
+	// Address of the SMTP server, host:port
+	Addr string
+	From string
+	To   []string
+	// Authentication on the server, none if nil
+	Auth smtp.Auth
+}
+
+// Name returns the address of the SMTP server
+func (e *Email) Name() string {
+	return "smtp://" + e.Addr
+}
+
+// Notify sends an email whose subject is the message of the alert
+// net/smtp has no timeout, the connection is dialed with ctx and its deadline is the one of ctx,
+// emailTimeout if it has none, a cancellation of ctx closes it
+func (e *Email) Notify(ctx context.Context, alert monitoring.AlertRecord) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(emailTimeout)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	return e.send(conn, alert)
+}
+
+// send sends the email of the alert over conn, like smtp.SendMail
+func (e *Email) send(conn net.Conn, alert monitoring.AlertRecord) error {
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.Auth != nil {
+		if err := client.Auth(e.Auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := Message(alert)
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", e.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&body, "Subject: [log-monitor] %s\r\n", message)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n", message)
+	if _, err := writer.Write([]byte(body.String())); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
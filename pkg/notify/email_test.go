@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP is a minimal SMTP server accepting a single mail, whose data is sent to mails
+func serveSMTP(t *testing.T, listener net.Listener, mails chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 send the data")
+			data, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			mails <- strings.Join(data, "\n")
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 %s not implemented", command)
+		}
+	}
+}
+
+func TestEmail_Notify(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	mails := make(chan string, 1)
+	go serveSMTP(t, listener, mails)
+
+	email := &Email{Addr: listener.Addr().String(), From: "monitor@example.com", To: []string{"ops@example.com", "dev@example.com"}}
+	alert := monitoring.AlertRecord{Alert: true, NumTraffic: 1300}
+	if err := email.Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	mail := <-mails
+	for _, want := range []string{"From: monitor@example.com", "To: ops@example.com, dev@example.com", "Subject: [log-monitor] " + Message(alert)} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("mail does not contain %q:\n%s", want, mail)
+		}
+	}
+}
+
+// Checks that a server that never answers does not block the notification beyond the deadline of the context
+func TestEmail_NotifyTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// The connection is accepted but the greeting is never sent
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+
+	email := &Email{Addr: listener.Addr().String(), From: "monitor@example.com", To: []string{"ops@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := email.Notify(ctx, monitoring.AlertRecord{Alert: true}); err == nil {
+		t.Errorf("Notify() should fail when the server does not answer")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify() took %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"log"
+	"sync"
+	"time"
+)
+
+// Notifier sends an alert to an external destination
+type Notifier interface {
+	// Notify sends the alert, an error means that it may be retried
+	Notify(ctx context.Context, alert monitoring.AlertRecord) error
+	// Name identifies the notifier in the error messages
+	Name() string
+}
+
+// Message returns the text describing an alert, as displayed in the alert panel
+func Message(alert monitoring.AlertRecord) string {
+	date := alert.Time.Format("15:04:05, January 02 2006")
+	switch {
+	case alert.Reload != "":
+		return fmt.Sprintf("Settings reloaded - %s, at %s", alert.Reload, date)
+	case alert.Rule != "" && alert.Alert:
+		return fmt.Sprintf("[%s] %s generated an alert - value = %.2f above %.2f, triggered at %s", alert.Severity, alert.Rule, alert.Value, alert.Threshold, date)
+	case alert.Rule != "":
+		return fmt.Sprintf("[%s] %s has recovered - value = %.2f, triggered at %s", alert.Severity, alert.Rule, alert.Value, date)
+	case alert.Alert:
+		return fmt.Sprintf("High traffic generated an alert - hits = %d, triggered at %s", alert.NumTraffic, date)
+	}
+	return fmt.Sprintf("High traffic has recovered, triggered at %s", date)
+}
+
+// Dispatcher is a Sink forwarding every alert transition to notifiers
+// Each notifier has its own goroutine sending its notifications in order, so a slow destination does not delay
+// the monitor nor the other notifiers and a recovery never arrives before its alert
+// A notification is retried with an exponential backoff and transitions already notified are dropped
+type Dispatcher struct {
+	// Number of attempts of each notification
+	Attempts int
+	// Wait before the first retry, it doubles after each attempt
+	Backoff time.Duration
+	// Timeout of each attempt
+	Timeout time.Duration
+	// Maximum time Close waits for the queued notifications, Timeout if 0
+	CloseTimeout time.Duration
+	// Logger of the notifications that failed after all attempts, discarded if nil
+	Logger *log.Logger
+
+	// notifications waiting to be sent, one queue per notifier
+	queues []*queue
+	// last state notified for each alert, the high traffic alert has an empty name
+	last map[string]bool
+	// goroutines sending the queued notifications, waited for by Close
+	wg sync.WaitGroup
+	// cancelled by Close once the in flight notifications had the time to finish
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewDispatcher returns a Dispatcher sending alerts to the notifiers
+// with 3 attempts, a backoff of 1 second and a timeout of 10 seconds
+func NewDispatcher(notifiers ...Notifier) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		Attempts: 3,
+		Backoff:  time.Second,
+		Timeout:  10 * time.Second,
+		last:     make(map[string]bool),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, notifier := range notifiers {
+		q := &queue{notifier: notifier, ready: make(chan struct{}, 1)}
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go d.run(q)
+	}
+	return d
+}
+
+// WriteStat does nothing, only alerts are notified
+func (d *Dispatcher) WriteStat(stat monitoring.StatRecord) error {
+	return nil
+}
+
+// WriteAlert notifies the alert unless the same transition of the same alert has already been notified
+// A reload of the settings is not notified
+func (d *Dispatcher) WriteAlert(alert monitoring.AlertRecord) error {
+	if alert.Reload != "" {
+		return nil
+	}
+	if last, ok := d.last[alert.Rule]; ok && last == alert.Alert {
+		return nil
+	}
+	// A recovery of an alert that has never fired is not worth a notification
+	if _, ok := d.last[alert.Rule]; !ok && !alert.Alert {
+		return nil
+	}
+	d.last[alert.Rule] = alert.Alert
+	// A resumed alert was notified before the restart, only its recovery is
+	if alert.Resumed {
+		return nil
+	}
+	for _, q := range d.queues {
+		q.push(alert)
+	}
+	return nil
+}
+
+// run sends the notifications of a queue one after the other until the queue is closed and empty
+func (d *Dispatcher) run(q *queue) {
+	defer d.wg.Done()
+	for {
+		alert, ok := q.pop()
+		if !ok {
+			return
+		}
+		if err := d.send(q.notifier, alert); err != nil && d.Logger != nil {
+			d.Logger.Printf("notification to %s failed: %v", q.notifier.Name(), err)
+		}
+	}
+}
+
+// send notifies alert with retries
+func (d *Dispatcher) send(notifier Notifier, alert monitoring.AlertRecord) error {
+	backoff := d.Backoff
+	var err error
+	for attempt := 1; attempt <= d.Attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(d.ctx, d.Timeout)
+		err = notifier.Notify(ctx, alert)
+		cancel()
+		if err == nil || attempt == d.Attempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.ctx.Done():
+			return err
+		}
+	}
+	return err
+}
+
+// Close waits for the notifications queued, at most for CloseTimeout
+// The notifications not sent by then are dropped
+func (d *Dispatcher) Close() error {
+	for _, q := range d.queues {
+		q.close()
+	}
+	done := make(chan bool)
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	timeout := d.CloseTimeout
+	if timeout == 0 {
+		timeout = d.Timeout
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+	return nil
+}
+
+// queue holds the notifications of a notifier not sent yet, in the order of the alerts
+// It is not bounded, so that WriteAlert never waits for a slow notifier
+type queue struct {
+	notifier Notifier
+	mutex    sync.Mutex
+	pending  []monitoring.AlertRecord
+	closed   bool
+	// ready receives a value when a notification is queued or the queue is closed
+	ready chan struct{}
+}
+
+// push adds a notification at the end of the queue
+func (q *queue) push(alert monitoring.AlertRecord) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, alert)
+	q.mutex.Unlock()
+	q.wake()
+}
+
+// close tells pop that no notification will be queued anymore
+func (q *queue) close() {
+	q.mutex.Lock()
+	q.closed = true
+	q.mutex.Unlock()
+	q.wake()
+}
+
+// wake wakes pop up, unless it already has a pending wake up
+func (q *queue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the first notification of the queue and removes it
+// It returns false once the queue is closed and empty
+func (q *queue) pop() (monitoring.AlertRecord, bool) {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) > 0 {
+			alert := q.pending[0]
+			q.pending = q.pending[1:]
+			q.mutex.Unlock()
+			return alert, true
+		}
+		closed := q.closed
+		q.mutex.Unlock()
+		if closed {
+			return monitoring.AlertRecord{}, false
+		}
+		<-q.ready
+	}
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records the alerts it receives and fails the first attempts
+// The notifications of an alert, not of a recovery, take delay
+type fakeNotifier struct {
+	mutex    sync.Mutex
+	delay    time.Duration
+	failures int
+	attempts int
+	alerts   []monitoring.AlertRecord
+}
+
+func (f *fakeNotifier) Name() string {
+	return "fake"
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, alert monitoring.AlertRecord) error {
+	if alert.Alert {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("unavailable")
+	}
+	f.alerts = append(f.alerts, alert)
+	return nil
+}
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		alert monitoring.AlertRecord
+		want  string
+	}{
+		{"test0", monitoring.AlertRecord{Alert: true, NumTraffic: 1300, Time: date}, "High traffic generated an alert - hits = 1300, triggered at 12:00:00, March 27 2020"},
+		{"test1", monitoring.AlertRecord{Alert: false, NumTraffic: 10, Time: date}, "High traffic has recovered, triggered at 12:00:00, March 27 2020"},
+		{"test2", monitoring.AlertRecord{Alert: true, Rule: "5xx", Value: 12.5, Threshold: 10, Severity: "critical", Time: date}, "[critical] 5xx generated an alert - value = 12.50 above 10.00, triggered at 12:00:00, March 27 2020"},
+		{"test3", monitoring.AlertRecord{Alert: false, Rule: "5xx", Value: 2, Severity: "critical", Time: date}, "[critical] 5xx has recovered - value = 2.00, triggered at 12:00:00, March 27 2020"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.alert); got != tt.want {
+				t.Errorf("Message() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that each transition is notified once to every notifier
+func TestDispatcher_dedup(t *testing.T) {
+	first, second := &fakeNotifier{}, &fakeNotifier{}
+	dispatcher := NewDispatcher(first, second)
+	for _, alert := range []monitoring.AlertRecord{
+		// Recovery of an alert that never fired
+		{Alert: false},
+		{Alert: true, NumTraffic: 1},
+		// Same transition sent again
+		{Alert: true, NumTraffic: 2},
+		{Alert: true, Rule: "5xx"},
+		{Alert: false, NumTraffic: 3},
+		{Alert: false, Rule: "5xx"},
+		{Alert: false, Rule: "5xx"},
+		// Alert already notified before a restart, only its recovery is notified
+		{Alert: true, Rule: "api", Resumed: true},
+		{Alert: false, Rule: "api"},
+		// A reload of the settings is not notified
+		{Reload: "threshold 20 (was 10)"},
+	} {
+		dispatcher.WriteAlert(alert)
+	}
+	dispatcher.Close()
+	for _, notifier := range []*fakeNotifier{first, second} {
+		if len(notifier.alerts) != 5 {
+			t.Errorf("notifier received %d alerts, want 5: %v", len(notifier.alerts), notifier.alerts)
+		}
+	}
+}
+
+// Checks that failed notifications are retried with a backoff
+func TestDispatcher_retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantAlerts int
+	}{
+		{"succeeds", 0, 1},
+		{"succeeds at the last attempt", 2, 1},
+		{"fails", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &fakeNotifier{failures: tt.failures}
+			dispatcher := NewDispatcher(notifier)
+			dispatcher.Backoff = 10 * time.Millisecond
+			start := time.Now()
+			dispatcher.WriteAlert(monitoring.AlertRecord{Alert: true})
+			dispatcher.Close()
+			if len(notifier.alerts) != tt.wantAlerts {
+				t.Errorf("notifier received %d alerts, want %d", len(notifier.alerts), tt.wantAlerts)
+			}
+			// 10ms then 20ms between the attempts
+			if tt.failures >= 2 && time.Since(start) < 30*time.Millisecond {
+				t.Errorf("retries did not wait for the backoff")
+			}
+		})
+	}
+}
+
+// Checks that the notifications reach a notifier in the order of the alerts, even if some take longer
+func TestDispatcher_order(t *testing.T) {
+	notifier := &fakeNotifier{delay: 20 * time.Millisecond}
+	dispatcher := NewDispatcher(notifier)
+	alerts := []monitoring.AlertRecord{
+		{Alert: true, NumTraffic: 1},
+		{Alert: false, NumTraffic: 2},
+		{Alert: true, NumTraffic: 3},
+		{Alert: false, NumTraffic: 4},
+	}
+	for _, alert := range alerts {
+		dispatcher.WriteAlert(alert)
+	}
+	dispatcher.Close()
+	if len(notifier.alerts) != len(alerts) {
+		t.Fatalf("notifier received %d alerts, want %d", len(notifier.alerts), len(alerts))
+	}
+	for i, alert := range notifier.alerts {
+		if alert.NumTraffic != alerts[i].NumTraffic {
+			t.Errorf("notification %d is %v, want %v", i, alert, alerts[i])
+		}
+	}
+}
+
+// Checks that Close gives up after CloseTimeout, whatever the timeout of each attempt
+func TestDispatcher_closeTimeout(t *testing.T) {
+	notifier := &fakeNotifier{delay: time.Hour}
+	dispatcher := NewDispatcher(notifier)
+	dispatcher.Attempts = 1
+	dispatcher.Timeout = time.Hour
+	dispatcher.CloseTimeout = 50 * time.Millisecond
+	dispatcher.WriteAlert(monitoring.AlertRecord{Alert: true})
+	start := time.Now()
+	dispatcher.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close() took %v, want about 50ms", elapsed)
+	}
+	if len(notifier.alerts) != 0 {
+		t.Errorf("notifier received %v, want nothing", notifier.alerts)
+	}
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Webhook is a Notifier posting each alert as a JSON body to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook posting to url with the default HTTP client
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: http.DefaultClient}
+}
+
+// Name returns the URL of the webhook
+func (w *Webhook) Name() string {
+	return w.URL
+}
+
+// Notify posts the alert and its message
+func (w *Webhook) Notify(ctx context.Context, alert monitoring.AlertRecord) error {
+	body, err := json.Marshal(struct {
+		monitoring.AlertRecord
+		Message string `json:"message"`
+	}{alert, Message(alert)})
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, body)
+}
+
+// Slack is a Notifier posting each alert to a Slack compatible incoming webhook
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewSlack returns a Slack notifier posting to the incoming webhook url with the default HTTP client
+func NewSlack(url string) *Slack {
+	return &Slack{URL: url, Client: http.DefaultClient}
+}
+
+// Name returns the URL of the incoming webhook
+func (s *Slack) Name() string {
+	return s.URL
+}
+
+// Notify posts the message of the alert, prefixed with an emoji giving its state
+func (s *Slack) Notify(ctx context.Context, alert monitoring.AlertRecord) error {
+	emoji := ":white_check_mark:"
+	if alert.Alert {
+		emoji = ":rotating_light:"
+	}
+	body, err := json.Marshal(map[string]string{"text": emoji + " " + Message(alert)})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, body)
+}
+
+// post posts a JSON body, any status other than 2xx is an error
+func post(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Read the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
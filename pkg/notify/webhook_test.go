@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	alert := monitoring.AlertRecord{Alert: true, NumTraffic: 1300, Time: time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)}
+	if err := NewWebhook(server.URL).Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if got["alert"] != true || got["traffic"] != 1300.0 || got["time"] != "2020-03-27T12:00:00Z" || got["message"] != Message(alert) {
+		t.Errorf("webhook received %v", got)
+	}
+}
+
+func TestSlack_Notify(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	alert := monitoring.AlertRecord{Alert: false, Rule: "5xx", Severity: "critical"}
+	if err := NewSlack(server.URL).Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != ":white_check_mark: "+Message(alert) {
+		t.Errorf("slack received %v", got)
+	}
+}
+
+// Checks that an error status is retried by the dispatcher until the server accepts the alert
+func TestWebhook_retry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL)
+	if err := webhook.Notify(context.Background(), monitoring.AlertRecord{Alert: true}); err == nil {
+		t.Errorf("Notify() should fail on a 503")
+	}
+	dispatcher := NewDispatcher(webhook)
+	dispatcher.Backoff = time.Millisecond
+	dispatcher.WriteAlert(monitoring.AlertRecord{Alert: true})
+	dispatcher.Close()
+	if calls != 3 {
+		t.Errorf("webhook was called %d times, want 3", calls)
+	}
+}
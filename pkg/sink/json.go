@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"encoding/json"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io"
+)
+
+// Types of the JSON lines
+const (
+	TypeStat  = "stat"
+	TypeAlert = "alert"
+)
+
+// JSON is a Sink writing each record as a JSON line
+// The "type" key of each line tells whether it is a "stat" or an "alert"
+type JSON struct {
+	encoder *json.Encoder
+	writer  io.Writer
+}
+
+// NewJSON returns a JSON sink writing to w
+// If w is an io.Closer, it is closed with the sink
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{encoder: json.NewEncoder(w), writer: w}
+}
+
+// WriteStat writes stat as a JSON line
+func (j *JSON) WriteStat(stat monitoring.StatRecord) error {
+	return j.encoder.Encode(struct {
+		Type string `json:"type"`
+		monitoring.StatRecord
+	}{TypeStat, stat})
+}
+
+// WriteAlert writes alert as a JSON line
+func (j *JSON) WriteAlert(alert monitoring.AlertRecord) error {
+	return j.encoder.Encode(struct {
+		Type string `json:"type"`
+		monitoring.AlertRecord
+	}{TypeAlert, alert})
+}
+
+// Close closes the underlying writer if it can be closed
+func (j *JSON) Close() error {
+	if closer, ok := j.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package sink
+
+import (
+	"bytes"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	j := NewJSON(&buffer)
+	date := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+
+	j.WriteStat(monitoring.StatRecord{
+		Time:        date,
+		TopSections: []monitoring.Pair{{Key: "/api", Value: 3}},
+		NumRequests: 3,
+		BytesCount:  "1.2 kB",
+	})
+	j.WriteAlert(monitoring.AlertRecord{Alert: true, NumTraffic: 1300, Time: date})
+	if err := j.Close(); err != nil {
+		t.Errorf("Close() err = %v", err)
+	}
+
+	want := `{"type":"stat","time":"2020-03-27T12:00:00Z","top_sections":[{"key":"/api","value":3}],"top_methods":null,"top_status":null,"top_hosts":null,"top_users":null,"requests":3,"bytes":"1.2 kB","parse_errors":0,"num_bytes":0,"window_traffic":0}
+{"type":"alert","alert":true,"traffic":1300,"time":"2020-03-27T12:00:00Z"}
+`
+	if got := buffer.String(); got != want {
+		t.Errorf("JSON wrote \n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package sink
+
+import (
+	"context"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+)
+
+// Sink receives the statistics and the alerts sent by the monitor
+// The terminal display and the headless writers are sinks, several of them can run side by side
+type Sink interface {
+	// WriteStat is called with each StatRecord sent by the monitor
+	WriteStat(stat monitoring.StatRecord) error
+	// WriteAlert is called with each AlertRecord sent by the monitor
+	WriteAlert(alert monitoring.AlertRecord) error
+	// Close is called once the monitor has stopped sending records
+	Close() error
+}
+
+// Dispatch forwards the records of the monitor channels to every sink, in the order they are received
+// It returns once both channels are closed, so the last records sent by a stopping monitor are not lost
+// The sinks are closed before returning
+// The first error of a sink stops the dispatching and is returned
+func Dispatch(statChan <-chan monitoring.StatRecord, alertChan <-chan monitoring.AlertRecord, sinks ...Sink) (err error) {
+	defer func() {
+		for _, s := range sinks {
+			if closeErr := s.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}()
+	for statChan != nil || alertChan != nil {
+		select {
+		case stat, ok := <-statChan:
+			if !ok {
+				statChan = nil
+				continue
+			}
+			for _, s := range sinks {
+				if err := s.WriteStat(stat); err != nil {
+					return err
+				}
+			}
+		case alert, ok := <-alertChan:
+			if !ok {
+				alertChan = nil
+				continue
+			}
+			for _, s := range sinks {
+				if err := s.WriteAlert(alert); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Channel is a Sink forwarding the records to a pair of channels, such as the ones of the display
+type Channel struct {
+	StatChan  chan monitoring.StatRecord
+	AlertChan chan monitoring.AlertRecord
+	ctx       context.Context
+}
+
+// NewChannel returns a Channel sink writing to statChan and alertChan
+// Writes are abandoned when ctx is cancelled so a stopped reader does not block the dispatching
+func NewChannel(ctx context.Context, statChan chan monitoring.StatRecord, alertChan chan monitoring.AlertRecord) *Channel {
+	return &Channel{StatChan: statChan, AlertChan: alertChan, ctx: ctx}
+}
+
+// WriteStat sends stat to the statistics channel
+func (c *Channel) WriteStat(stat monitoring.StatRecord) error {
+	select {
+	case c.StatChan <- stat:
+	case <-c.ctx.Done():
+	}
+	return nil
+}
+
+// WriteAlert sends alert to the alert channel
+func (c *Channel) WriteAlert(alert monitoring.AlertRecord) error {
+	select {
+	case c.AlertChan <- alert:
+	case <-c.ctx.Done():
+	}
+	return nil
+}
+
+// Close closes both channels, which tells the reader that there is nothing more to read
+func (c *Channel) Close() error {
+	close(c.StatChan)
+	close(c.AlertChan)
+	return nil
+}
@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recorder is a Sink keeping every record it receives
+type recorder struct {
+	stats  []monitoring.StatRecord
+	alerts []monitoring.AlertRecord
+	closed bool
+	err    error
+}
+
+func (r *recorder) WriteStat(stat monitoring.StatRecord) error {
+	r.stats = append(r.stats, stat)
+	return r.err
+}
+
+func (r *recorder) WriteAlert(alert monitoring.AlertRecord) error {
+	r.alerts = append(r.alerts, alert)
+	return r.err
+}
+
+func (r *recorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+// Checks that every sink receives every record and is closed once the channels are closed
+func TestDispatch(t *testing.T) {
+	statChan := make(chan monitoring.StatRecord)
+	alertChan := make(chan monitoring.AlertRecord)
+	go func() {
+		for i := 0; i < 5; i++ {
+			statChan <- monitoring.StatRecord{NumRequests: i}
+			alertChan <- monitoring.AlertRecord{Alert: i%2 == 0, NumTraffic: i}
+		}
+		close(statChan)
+		close(alertChan)
+	}()
+
+	sinks := []*recorder{{}, {}}
+	if err := Dispatch(statChan, alertChan, sinks[0], sinks[1]); err != nil {
+		t.Fatalf("Dispatch() err = %v", err)
+	}
+	for i, s := range sinks {
+		if len(s.stats) != 5 || len(s.alerts) != 5 || !s.closed {
+			t.Errorf("sink %d got %d stats, %d alerts, closed %v", i, len(s.stats), len(s.alerts), s.closed)
+		}
+		if !reflect.DeepEqual(s.stats, sinks[0].stats) {
+			t.Errorf("sink %d got different stats than sink 0", i)
+		}
+	}
+}
+
+// Checks that an error of a sink stops the dispatching
+func TestDispatch_error(t *testing.T) {
+	statChan := make(chan monitoring.StatRecord, 1)
+	alertChan := make(chan monitoring.AlertRecord)
+	statChan <- monitoring.StatRecord{}
+
+	failing := &recorder{err: errors.New("broken pipe")}
+	if err := Dispatch(statChan, alertChan, failing); err == nil || !failing.closed {
+		t.Errorf("Dispatch() err = %v, closed %v", err, failing.closed)
+	}
+}
+
+// Checks that a Channel sink does not block once the context is cancelled
+func TestChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statChan := make(chan monitoring.StatRecord)
+	alertChan := make(chan monitoring.AlertRecord)
+	channel := NewChannel(ctx, statChan, alertChan)
+
+	go channel.WriteStat(monitoring.StatRecord{NumRequests: 3})
+	if got := <-statChan; got.NumRequests != 3 {
+		t.Errorf("WriteStat() sent %v", got)
+	}
+
+	cancel()
+	done := make(chan bool)
+	go func() {
+		channel.WriteAlert(monitoring.AlertRecord{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("WriteAlert() is blocked after the cancellation")
+	}
+
+	channel.Close()
+	if _, ok := <-statChan; ok {
+		t.Errorf("Close() did not close the channels")
+	}
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A segment holds the points of one level and of one day, named after the day such as 2020-03-27.seg
+// It is only appended to, each point is a record:
+//
+//	length of the payload (uvarint) | payload (JSON) | CRC-32 of the payload (4 bytes, big endian)
+//
+// A record cut by a crash is detected by its length or its checksum, it is dropped with the records after it
+const (
+	segmentExt    = ".seg"
+	segmentLayout = "2006-01-02"
+	// maxPayload bounds the length read from a damaged record
+	maxPayload = 16 << 20
+)
+
+// errCorrupted is returned by readRecord when a record is truncated or damaged
+var errCorrupted = errors.New("corrupted record")
+
+// segmentName returns the name of the segment holding the points of the day of t
+func segmentName(t time.Time) string {
+	return t.UTC().Format(segmentLayout) + segmentExt
+}
+
+// segmentDay returns the day of a segment from its name, ok is false if name is not a segment
+func segmentDay(name string) (day time.Time, ok bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return time.Time{}, false
+	}
+	day, err := time.Parse(segmentLayout, strings.TrimSuffix(name, segmentExt))
+	return day, err == nil
+}
+
+// segments returns the days of the segments of dir, from the oldest
+func segments(dir string) ([]time.Time, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var days []time.Time
+	for _, entry := range entries {
+		if day, ok := segmentDay(entry.Name()); ok && !entry.IsDir() {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// writeRecord appends the record of point to w
+func writeRecord(w io.Writer, point Point) error {
+	payload, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(payload)+4)
+	record = record[:binary.PutUvarint(record, uint64(len(payload)))]
+	record = append(record, payload...)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+	record = append(record, sum[:]...)
+	// A single write so that a crash cuts at most the last record
+	_, err = w.Write(record)
+	return err
+}
+
+// readRecord reads the next record of r and returns its point and its length
+// io.EOF is returned at the end of the segment and errCorrupted if the rest of the segment cannot be read
+func readRecord(r *bufio.Reader) (Point, int, error) {
+	var point Point
+	length, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return point, 0, io.EOF
+	}
+	if err != nil || length > maxPayload {
+		return point, 0, errCorrupted
+	}
+	record := make([]byte, length+4)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return point, 0, errCorrupted
+	}
+	payload := record[:length]
+	if binary.BigEndian.Uint32(record[length:]) != crc32.ChecksumIEEE(payload) {
+		return point, 0, errCorrupted
+	}
+	if err := json.Unmarshal(payload, &point); err != nil {
+		return point, 0, errCorrupted
+	}
+	return point, uvarintLen(length) + len(record), nil
+}
+
+// uvarintLen returns the number of bytes of the uvarint encoding of x
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+// readSegment calls f with each point of the segment at path
+// It returns the length of the valid records, the records after it were cut by a crash and are ignored
+func readSegment(path string, f func(point Point)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var valid int64
+	for {
+		point, n, err := readRecord(reader)
+		if err != nil {
+			// io.EOF or errCorrupted
+			return valid, nil
+		}
+		valid += int64(n)
+		f(point)
+	}
+}
+
+// openSegment opens the segment at path for appending, creating it if needed
+// A record cut by a crash is truncated so that the next records can be read
+func openSegment(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := readSegment(path, func(Point) {})
+	if err == nil {
+		err = file.Truncate(valid)
+	}
+	if err == nil {
+		_, err = file.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tempDir creates a temporary directory removed at the end of the test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// Checks that the records cut by a crash or damaged are dropped, and truncated before appending
+func TestSegment(t *testing.T) {
+	start := time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// damage applied to the segment of 3 points
+		damage func(data []byte) []byte
+		want   int
+	}{
+		{"test0", func(data []byte) []byte { return data }, 3},
+		{"test1", func(data []byte) []byte { return data[:len(data)-1] }, 2},
+		{"test2", func(data []byte) []byte { return data[:len(data)-10] }, 2},
+		{"test3", func(data []byte) []byte {
+			data[len(data)-5] ^= 0xff
+			return data
+		}, 2},
+		{"test4", func(data []byte) []byte { return append(data, 0xff) }, 3},
+		{"test5", func(data []byte) []byte { return data[:1] }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir(t), segmentName(start))
+			file, err := openSegment(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if err := writeRecord(file, Point{Time: start.Add(time.Duration(i) * 10 * time.Second), NumRequests: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			file.Close()
+			data, _ := ioutil.ReadFile(path)
+			ioutil.WriteFile(path, tt.damage(data), 0644)
+
+			var got []Point
+			readSegment(path, func(point Point) { got = append(got, point) })
+			if len(got) != tt.want {
+				t.Fatalf("read %d points, want %d", len(got), tt.want)
+			}
+			for i, point := range got {
+				if point.NumRequests != i || !point.Time.Equal(start.Add(time.Duration(i)*10*time.Second)) {
+					t.Errorf("point %d = %+v", i, point)
+				}
+			}
+
+			// The damaged tail is replaced by the next record
+			file, err = openSegment(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeRecord(file, Point{Time: start.Add(time.Minute), NumRequests: 10})
+			file.Close()
+			got = nil
+			readSegment(path, func(point Point) { got = append(got, point) })
+			if len(got) != tt.want+1 || got[tt.want].NumRequests != 10 {
+				t.Errorf("read %+v after appending", got)
+			}
+		})
+	}
+}
+
+// Checks that only the segment files are listed, from the oldest day
+func TestSegments(t *testing.T) {
+	dir := tempDir(t)
+	for _, name := range []string{"2020-03-28.seg", "2020-03-27.seg", "notes.txt", "2020-13-01.seg"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	days, err := segments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || segmentName(days[0]) != "2020-03-27.seg" || segmentName(days[1]) != "2020-03-28.seg" {
+		t.Errorf("segments() = %v", days)
+	}
+	if days, err := segments(filepath.Join(dir, "missing")); err != nil || len(days) != 0 {
+		t.Errorf("segments() of a missing directory = %v, %v", days, err)
+	}
+}
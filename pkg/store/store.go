@@ -0,0 +1,413 @@
+// Package store keeps the statistics of every interval on disk so that the history survives the restarts
+// The points are appended to daily segments, rolled up into points of one minute and one hour,
+// and each resolution is deleted after its own retention
+package store
+
+import (
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolutions of the points, the name of their directory in the store
+const (
+	// Raw points are the intervals sent by the monitor
+	Raw    = "raw"
+	Minute = "1m"
+	Hour   = "1h"
+)
+
+// day is the length of a segment
+const day = 24 * time.Hour
+
+// Point is the aggregates of an interval, or of the intervals of a minute or an hour
+type Point struct {
+	// Start of the interval, minute or hour
+	Time time.Time `json:"time"`
+	// Number of intervals summed
+	Intervals   int `json:"intervals"`
+	NumRequests int `json:"requests"`
+	NumBytes    int `json:"bytes"`
+	ParseErrors int `json:"parse_errors"`
+	// Hits of every section/method/status class
+	Sections map[string]int `json:"sections,omitempty"`
+	Methods  map[string]int `json:"methods,omitempty"`
+	Status   map[string]int `json:"status,omitempty"`
+}
+
+// pointOf returns the point of the statistics of an interval
+func pointOf(stat monitoring.StatRecord) Point {
+	return Point{
+		Time:        stat.Time,
+		Intervals:   1,
+		NumRequests: stat.NumRequests,
+		NumBytes:    stat.NumBytes,
+		ParseErrors: stat.ParseErrors,
+		Sections:    stat.Sections,
+		Methods:     stat.Methods,
+		Status:      stat.Status,
+	}
+}
+
+// add adds the counts of other to p, the maps of other are not modified
+func (p *Point) add(other Point) {
+	p.Intervals += other.Intervals
+	p.NumRequests += other.NumRequests
+	p.NumBytes += other.NumBytes
+	p.ParseErrors += other.ParseErrors
+	p.Sections = addCounts(p.Sections, other.Sections)
+	p.Methods = addCounts(p.Methods, other.Methods)
+	p.Status = addCounts(p.Status, other.Status)
+}
+
+// addCounts adds counts to totals, allocating totals if needed
+func addCounts(totals map[string]int, counts map[string]int) map[string]int {
+	if totals == nil && len(counts) > 0 {
+		totals = make(map[string]int, len(counts))
+	}
+	for key, value := range counts {
+		totals[key] += value
+	}
+	return totals
+}
+
+// Retention gives how long the points of each resolution are kept
+type Retention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// DefaultRetention keeps the intervals two days, the minutes a month and the hours a year
+var DefaultRetention = Retention{Raw: 2 * day, Minute: 30 * day, Hour: 365 * day}
+
+// String returns the retention in the format read by ParseRetention
+func (r Retention) String() string {
+	return fmt.Sprintf("%s=%s,%s=%s,%s=%s", Raw, fmtHours(r.Raw), Minute, fmtHours(r.Minute), Hour, fmtHours(r.Hour))
+}
+
+// fmtHours formats a duration of whole hours without the trailing 0m0s
+func fmtHours(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
+
+// ParseRetention reads a retention such as raw=48h,1m=720h,1h=8760h
+// The resolutions not given keep their default retention
+func ParseRetention(s string) (Retention, error) {
+	r := DefaultRetention
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return r, fmt.Errorf("invalid retention %q, expected resolution=duration such as 1h=8760h", field)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d <= 0 {
+			return r, fmt.Errorf("invalid retention %q, expected a positive duration", field)
+		}
+		switch parts[0] {
+		case Raw:
+			r.Raw = d
+		case Minute:
+			r.Minute = d
+		case Hour:
+			r.Hour = d
+		default:
+			return r, fmt.Errorf("unknown resolution %s, expected raw, 1m or 1h", parts[0])
+		}
+	}
+	return r, nil
+}
+
+// level is the points of one resolution
+type level struct {
+	name string
+	// duration of the points, 0 for the raw intervals
+	resolution time.Duration
+	retention  time.Duration
+	// segment being appended to and its day
+	file *os.File
+	day  time.Time
+	// point of the current minute or hour, written once the next one starts
+	pending *Point
+}
+
+// Store is a Sink writing the statistics of each interval to a directory, with a sub-directory by resolution
+type Store struct {
+	dir string
+	// mutex for thread safety, the sink and the readers such as the API run in different goroutines
+	mutex sync.Mutex
+	// raw, minute and hour levels, each one rolled up into the next one
+	levels []*level
+	// latest interval written
+	latest time.Time
+}
+
+// Open opens the store of dir, creating it if needed
+// The minutes and hours left pending by a crash are rebuilt from the points of the finer resolution
+func Open(dir string, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir: dir,
+		levels: []*level{
+			{name: Raw, retention: retention.Raw},
+			{name: Minute, resolution: time.Minute, retention: retention.Minute},
+			{name: Hour, resolution: time.Hour, retention: retention.Hour},
+		},
+	}
+	latest, err := s.last(0)
+	if err != nil {
+		return nil, err
+	}
+	s.latest = latest
+	// From the hours, so that the minutes completed by the rebuild are rolled up into the rebuilt hour
+	for i := len(s.levels) - 1; i > 0; i-- {
+		var from time.Time
+		last, err := s.last(i)
+		if err != nil {
+			return nil, err
+		}
+		if !last.IsZero() {
+			from = last.Add(s.levels[i].resolution)
+		}
+		points, err := s.read(i-1, from, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range merge(points) {
+			if err := s.roll(i, point); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// WriteStat appends the statistics of an interval
+func (s *Store) WriteStat(stat monitoring.StatRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stat.Time.After(s.latest) {
+		s.latest = stat.Time
+	}
+	return s.add(0, pointOf(stat))
+}
+
+// WriteAlert does nothing, only the statistics are stored
+func (s *Store) WriteAlert(alert monitoring.AlertRecord) error {
+	return nil
+}
+
+// Close writes the pending minute and hour and closes the segments
+// The points of a minute or an hour continued after a restart are summed by Query
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var err error
+	for i, l := range s.levels {
+		if l.pending != nil {
+			point := *l.pending
+			l.pending = nil
+			if addErr := s.add(i, point); err == nil {
+				err = addErr
+			}
+		}
+	}
+	for _, l := range s.levels {
+		if l.file != nil {
+			if closeErr := l.file.Close(); err == nil {
+				err = closeErr
+			}
+			l.file = nil
+		}
+	}
+	return err
+}
+
+// Latest returns the start of the latest interval written, the zero time if the store is empty
+func (s *Store) Latest() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+// Query returns the points of a resolution from the one holding from and starting before to, from the oldest
+// A zero to has no bound, the points of the current minute and hour are included
+func (s *Store) Query(resolution string, from time.Time, to time.Time) ([]Point, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, l := range s.levels {
+		if l.name != resolution {
+			continue
+		}
+		from = from.Truncate(l.resolution)
+		points, err := s.read(i, from, to)
+		if err != nil {
+			return nil, err
+		}
+		// The pending points of the finer resolutions are not rolled up yet, they are added to their minute or hour
+		for _, finer := range s.levels[1 : i+1] {
+			if finer.pending == nil {
+				continue
+			}
+			point := *finer.pending
+			point.Time = point.Time.Truncate(l.resolution)
+			if inRange(point.Time, from, to) {
+				points = append(points, point)
+			}
+		}
+		return merge(points), nil
+	}
+	return nil, fmt.Errorf("unknown resolution %s, expected raw, 1m or 1h", resolution)
+}
+
+// inRange returns true if t is in [from, to), a zero to has no bound
+func inRange(t time.Time, from time.Time, to time.Time) bool {
+	return !t.Before(from) && (to.IsZero() || t.Before(to))
+}
+
+// merge sorts the points and sums the ones of the same time, written before and after a restart
+func merge(points []Point) []Point {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	merged := make([]Point, 0, len(points))
+	for _, point := range points {
+		if n := len(merged); n > 0 && merged[n-1].Time.Equal(point.Time) {
+			merged[n-1].add(point)
+			continue
+		}
+		var copied Point
+		copied.Time = point.Time
+		copied.add(point)
+		merged = append(merged, copied)
+	}
+	return merged
+}
+
+// add appends a point to level i and rolls it up into the next level
+// the caller must hold the mutex
+func (s *Store) add(i int, point Point) error {
+	if err := s.append(i, point); err != nil {
+		return err
+	}
+	if i+1 < len(s.levels) {
+		return s.roll(i+1, point)
+	}
+	return nil
+}
+
+// roll sums a point of level i-1 into the pending point of level i
+// The pending point is written first if the point starts another minute or hour
+func (s *Store) roll(i int, point Point) error {
+	l := s.levels[i]
+	bucket := point.Time.Truncate(l.resolution)
+	if l.pending != nil && !l.pending.Time.Equal(bucket) {
+		done := *l.pending
+		l.pending = nil
+		if err := s.add(i, done); err != nil {
+			return err
+		}
+	}
+	if l.pending == nil {
+		l.pending = &Point{Time: bucket}
+	}
+	l.pending.add(point)
+	return nil
+}
+
+// append writes a point to the segment of its day in level i
+// The segments past the retention are deleted when a new day starts
+func (s *Store) append(i int, point Point) error {
+	l := s.levels[i]
+	pointDay := point.Time.UTC().Truncate(day)
+	if l.file == nil || !l.day.Equal(pointDay) {
+		if l.file != nil {
+			if err := l.file.Close(); err != nil {
+				return err
+			}
+			l.file = nil
+		}
+		file, err := openSegment(filepath.Join(s.dir, l.name, segmentName(pointDay)))
+		if err != nil {
+			return err
+		}
+		l.file, l.day = file, pointDay
+		if err := s.prune(i); err != nil {
+			return err
+		}
+	}
+	return writeRecord(l.file, point)
+}
+
+// prune deletes the segments of level i whose points are all older than its retention before the latest interval
+func (s *Store) prune(i int) error {
+	l := s.levels[i]
+	dir := filepath.Join(s.dir, l.name)
+	days, err := segments(dir)
+	if err != nil {
+		return err
+	}
+	cutoff := s.latest.Add(-l.retention)
+	for _, segmentDay := range days {
+		if segmentDay.Add(day).After(cutoff) || segmentDay.Equal(l.day) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, segmentName(segmentDay))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the points written to level i from from and before to, in the order of the segments
+func (s *Store) read(i int, from time.Time, to time.Time) ([]Point, error) {
+	dir := filepath.Join(s.dir, s.levels[i].name)
+	days, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	var points []Point
+	for _, segmentDay := range days {
+		if !segmentDay.Add(day).After(from) || (!to.IsZero() && !segmentDay.Before(to)) {
+			continue
+		}
+		_, err := readSegment(filepath.Join(dir, segmentName(segmentDay)), func(point Point) {
+			if inRange(point.Time, from, to) {
+				points = append(points, point)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// last returns the time of the latest point written to level i, the zero time if there is none
+func (s *Store) last(i int) (time.Time, error) {
+	dir := filepath.Join(s.dir, s.levels[i].name)
+	days, err := segments(dir)
+	if err != nil || len(days) == 0 {
+		return time.Time{}, err
+	}
+	var last time.Time
+	_, err = readSegment(filepath.Join(dir, segmentName(days[len(days)-1])), func(point Point) {
+		if point.Time.After(last) {
+			last = point.Time
+		}
+	})
+	return last, err
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// start is the time of the first interval written by the tests
+var start = time.Date(2020, 3, 27, 12, 0, 0, 0, time.UTC)
+
+// writeIntervals writes the intervals of 10 seconds from start+from to start+to, each one of one GET /api request
+func writeIntervals(t *testing.T, s *Store, from time.Duration, to time.Duration) {
+	for d := from; d < to; d += 10 * time.Second {
+		stat := monitoring.StatRecord{
+			Time:        start.Add(d),
+			NumRequests: 1,
+			NumBytes:    100,
+			Sections:    map[string]int{"/api": 1},
+			Methods:     map[string]int{"GET": 1},
+			Status:      map[string]int{"2xx": 1},
+		}
+		if err := s.WriteStat(stat); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// requests returns the start and the number of requests of each point
+func requests(t *testing.T, s *Store, resolution string) map[string]int {
+	points, err := s.Query(resolution, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, point := range points {
+		got[point.Time.Format("15:04:05")] = point.NumRequests
+		if point.Sections["/api"] != point.NumRequests || point.Intervals != point.NumRequests || point.NumBytes != 100*point.NumRequests {
+			t.Errorf("%s point %+v", resolution, point)
+		}
+	}
+	return got
+}
+
+// openStore opens the store of dir with the default retention
+func openStore(t *testing.T, dir string) *Store {
+	s, err := Open(dir, DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Checks the rollups of the intervals into minutes and hours, across a restart or a crash
+func TestStore(t *testing.T) {
+	minutes := map[string]int{"12:00:00": 6, "12:01:00": 6, "12:02:00": 6}
+	hours := map[string]int{"12:00:00": 18}
+	tests := []struct {
+		name string
+		// writes the intervals from 12:00:00 to 12:03:00
+		write func(t *testing.T, dir string) *Store
+	}{
+		{"test0", func(t *testing.T, dir string) *Store {
+			s := openStore(t, dir)
+			writeIntervals(t, s, 0, 3*time.Minute)
+			return s
+		}},
+		// Restarted in the middle of a minute
+		{"test1", func(t *testing.T, dir string) *Store {
+			s := openStore(t, dir)
+			writeIntervals(t, s, 0, 90*time.Second)
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = openStore(t, dir)
+			writeIntervals(t, s, 90*time.Second, 3*time.Minute)
+			return s
+		}},
+		// Crashed without writing the pending minute and hour
+		{"test2", func(t *testing.T, dir string) *Store {
+			s := openStore(t, dir)
+			writeIntervals(t, s, 0, 150*time.Second)
+			s = openStore(t, dir)
+			writeIntervals(t, s, 150*time.Second, 3*time.Minute)
+			return s
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			s := tt.write(t, dir)
+			if got := requests(t, s, Raw); len(got) != 18 {
+				t.Errorf("%d intervals, want 18", len(got))
+			}
+			if got := requests(t, s, Minute); !reflect.DeepEqual(got, minutes) {
+				t.Errorf("minutes = %v, want %v", got, minutes)
+			}
+			if got := requests(t, s, Hour); !reflect.DeepEqual(got, hours) {
+				t.Errorf("hours = %v, want %v", got, hours)
+			}
+			if latest := s.Latest(); !latest.Equal(start.Add(170 * time.Second)) {
+				t.Errorf("Latest() = %v", latest)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Nothing is lost or counted twice once reopened
+			s = openStore(t, dir)
+			defer s.Close()
+			if got := requests(t, s, Minute); !reflect.DeepEqual(got, minutes) {
+				t.Errorf("minutes = %v after reopening, want %v", got, minutes)
+			}
+			if got := requests(t, s, Hour); !reflect.DeepEqual(got, hours) {
+				t.Errorf("hours = %v after reopening, want %v", got, hours)
+			}
+		})
+	}
+}
+
+// Checks the bounds of the queries
+func TestStore_Query(t *testing.T) {
+	s := openStore(t, tempDir(t))
+	defer s.Close()
+	writeIntervals(t, s, 0, 3*time.Minute)
+	tests := []struct {
+		name       string
+		resolution string
+		from       time.Time
+		to         time.Time
+		want       int
+	}{
+		{"test0", Raw, start.Add(time.Minute), time.Time{}, 12},
+		{"test1", Raw, start.Add(time.Minute), start.Add(2 * time.Minute), 6},
+		{"test2", Minute, start.Add(2 * time.Minute), time.Time{}, 1},
+		{"test3", Minute, time.Time{}, start.Add(2 * time.Minute), 2},
+		{"test4", Hour, start.Add(time.Minute), time.Time{}, 1},
+		{"test5", Minute, start.Add(150 * time.Second), time.Time{}, 1},
+		{"test6", Raw, start.Add(time.Hour), time.Time{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := s.Query(tt.resolution, tt.from, tt.to)
+			if err != nil || len(points) != tt.want {
+				t.Errorf("Query() = %d points, %v, want %d", len(points), err, tt.want)
+			}
+		})
+	}
+	if _, err := s.Query("1d", time.Time{}, time.Time{}); err == nil {
+		t.Error("Query() of an unknown resolution did not fail")
+	}
+}
+
+// Checks that the segments are deleted after the retention of their resolution
+func TestStore_retention(t *testing.T) {
+	dir := tempDir(t)
+	s, err := Open(dir, Retention{Raw: day, Minute: 2 * day, Hour: 365 * day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, d := range []time.Duration{0, day, 2 * day, 3 * day, 3*day + time.Minute} {
+		writeIntervals(t, s, d, d+10*time.Second)
+	}
+	tests := []struct {
+		name       string
+		resolution string
+		want       []string
+	}{
+		{"test0", Raw, []string{"2020-03-29.seg", "2020-03-30.seg"}},
+		{"test1", Minute, []string{"2020-03-28.seg", "2020-03-29.seg", "2020-03-30.seg"}},
+		{"test2", Hour, []string{"2020-03-27.seg", "2020-03-28.seg", "2020-03-29.seg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, err := segments(filepath.Join(dir, tt.resolution))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, segmentDay := range days {
+				got = append(got, segmentName(segmentDay))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Checks the parsing of the retention
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Retention
+		wantErr bool
+	}{
+		{"test0", "", DefaultRetention, false},
+		{"test1", DefaultRetention.String(), DefaultRetention, false},
+		{"test2", "raw=12h, 1h=720h", Retention{Raw: 12 * time.Hour, Minute: DefaultRetention.Minute, Hour: 720 * time.Hour}, false},
+		{"test3", "1m=90m", Retention{Raw: DefaultRetention.Raw, Minute: 90 * time.Minute, Hour: DefaultRetention.Hour}, false},
+		{"test4", "1d=720h", DefaultRetention, true},
+		{"test5", "raw", DefaultRetention, true},
+		{"test6", "raw=-1h", DefaultRetention, true},
+		{"test7", "raw=7d", DefaultRetention, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.value)
+			if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+				t.Errorf("ParseRetention() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+	if got := DefaultRetention.String(); got != "raw=48h,1m=720h,1h=8760h" {
+		t.Errorf("String() = %s", got)
+	}
+}
@@ -0,0 +1,86 @@
+package syslog
+
+import (
+	"strings"
+	"time"
+)
+
+// bom is the byte order mark a RFC 5424 message may start with
+const bom = "\xef\xbb\xbf"
+
+// Payload strips the syslog envelope of a message and returns its content, the access log line
+// Both the RFC 5424 and the RFC 3164 (BSD) formats are read, a message without envelope is returned as is
+func Payload(message string) string {
+	message = strings.TrimRight(message, "\r\n\x00")
+	if !strings.HasPrefix(message, "<") {
+		return message
+	}
+	end := strings.IndexByte(message, '>')
+	if end < 2 || end > 4 || !digits(message[1:end]) {
+		return message
+	}
+	rest := message[end+1:]
+	// RFC 5424 messages give their version after the priority
+	if space := strings.IndexByte(rest, ' '); space > 0 && digits(rest[:space]) {
+		return payload5424(rest[space+1:])
+	}
+	return payload3164(rest)
+}
+
+// payload5424 returns the content of a RFC 5424 message after its version
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func payload5424(rest string) string {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return ""
+	}
+	data := fields[5]
+	i := 0
+	if strings.HasPrefix(data, "-") {
+		i = 1
+	}
+	// Skip the structured data elements, a ] in a parameter value is escaped with a backslash
+	for i < len(data) && data[i] == '[' {
+		for i++; i < len(data) && data[i] != ']'; i++ {
+			if data[i] == '\\' {
+				i++
+			}
+		}
+		i++
+	}
+	if i >= len(data) {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(data[i:], " "), bom)
+}
+
+// payload3164 returns the content of a RFC 3164 message after its priority
+// Mmm dd hh:mm:ss HOSTNAME TAG: MSG
+func payload3164(rest string) string {
+	if len(rest) < len(time.Stamp)+1 {
+		return rest
+	}
+	if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err != nil {
+		return rest
+	}
+	rest = rest[len(time.Stamp)+1:]
+	// The hostname may be omitted, the tag comes first then
+	if space := strings.IndexByte(rest, ' '); space > 0 && !strings.HasSuffix(rest[:space], ":") {
+		rest = rest[space+1:]
+	}
+	// The tag is a single word ending with a colon, nginx: or nginx[1234]:
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.Contains(rest[:colon], " ") {
+		return rest[colon+2:]
+	}
+	return rest
+}
+
+// digits tells whether s is only made of digits
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
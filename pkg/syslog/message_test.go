@@ -0,0 +1,33 @@
+package syslog
+
+import "testing"
+
+func TestPayload(t *testing.T) {
+	line := `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		// RFC 3164, as sent by nginx
+		{"test0", "<190>Mar 27 12:00:00 edge-1 nginx: " + line, line},
+		{"test1", "<190>Mar  7 12:00:00 edge-1 nginx[1234]: " + line + "\n", line},
+		// RFC 3164 without hostname
+		{"test2", "<190>Mar 27 12:00:00 nginx: " + line, line},
+		// RFC 5424 without structured data
+		{"test3", "<165>1 2020-03-27T12:00:00.003Z edge-1 nginx 1234 access - " + line, line},
+		// RFC 5424 with structured data and a byte order mark
+		{"test4", `<165>1 2020-03-27T12:00:00Z edge-1 nginx - - [meta sequenceId="1"][origin ip="10.0.0.1" x="a\]b"] ` + bom + line, line},
+		{"test5", "<165>1 2020-03-27T12:00:00Z edge-1 nginx - - -", ""},
+		// Without envelope
+		{"test6", line + "\r\n", line},
+		{"test7", "<abc>" + line, "<abc>" + line},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Payload(tt.message); got != tt.want {
+				t.Errorf("Payload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxMessageSize is the size of the largest message received, the largest UDP datagram
+const maxMessageSize = 64 * 1024
+
+// maxLengthDigits is the number of digits of maxMessageSize, the longest length of an octet counted message
+var maxLengthDigits = len(strconv.Itoa(maxMessageSize))
+
+// Schemes of the listen address
+const (
+	// SchemeSyslog listens on both UDP and TCP
+	SchemeSyslog = "syslog"
+	SchemeUDP    = "syslog+udp"
+	SchemeTCP    = "syslog+tcp"
+)
+
+// Server receives syslog messages over UDP and TCP, it is a LineSource of the monitor
+// The lines are the payloads of the messages, their syslog envelope is stripped
+type Server struct {
+	address string
+	// Bound listeners, nil if the protocol is not used
+	udp net.PacketConn
+	tcp net.Listener
+	// Connections being read, closed with the server
+	mutex sync.Mutex
+	conns map[net.Conn]bool
+	once  sync.Once
+}
+
+// Listen binds the listeners of address, for instance syslog://:5514
+// syslog:// listens on UDP and TCP, syslog+udp:// and syslog+tcp:// on a single protocol
+func Listen(address string) (*Server, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("listen address %s has no port", address)
+	}
+	s := &Server{address: address, conns: make(map[net.Conn]bool)}
+	switch u.Scheme {
+	case SchemeSyslog, SchemeUDP, SchemeTCP:
+	default:
+		return nil, fmt.Errorf("unknown listen scheme %q, expected %s, %s or %s", u.Scheme, SchemeSyslog, SchemeUDP, SchemeTCP)
+	}
+	if u.Scheme != SchemeTCP {
+		if s.udp, err = net.ListenPacket("udp", u.Host); err != nil {
+			return nil, err
+		}
+	}
+	if u.Scheme != SchemeUDP {
+		if s.tcp, err = net.Listen("tcp", u.Host); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Name returns the listen address
+func (s *Server) Name() string {
+	return s.address
+}
+
+// UDPAddr returns the bound UDP address, nil if UDP is not used
+func (s *Server) UDPAddr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr returns the bound TCP address, nil if TCP is not used
+func (s *Server) TCPAddr() net.Addr {
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// Read passes the payload of each message received to handle until handle returns false or ctx is cancelled
+// The server is closed when Read returns
+func (s *Server) Read(ctx context.Context, handle func(monitoring.Line) bool) error {
+	defer s.Close()
+	messages := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	errc := make(chan error, 2)
+	if s.udp != nil {
+		go func() {
+			errc <- s.readUDP(messages, done)
+		}()
+	}
+	if s.tcp != nil {
+		go func() {
+			errc <- s.accept(messages, done)
+		}()
+	}
+	for {
+		select {
+		case message := <-messages:
+			if !handle(monitoring.Line{Text: Payload(message)}) {
+				return nil
+			}
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Close closes the listeners and the connections being read
+func (s *Server) Close() error {
+	s.once.Do(func() {
+		if s.udp != nil {
+			s.udp.Close()
+		}
+		if s.tcp != nil {
+			s.tcp.Close()
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.conns = nil
+	})
+	return nil
+}
+
+// send passes a message to Read, it returns false once Read has returned
+func send(messages chan<- string, done <-chan struct{}, message string) bool {
+	select {
+	case messages <- message:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// readUDP reads the datagrams, each of them is a message
+func (s *Server) readUDP(messages chan<- string, done <-chan struct{}) error {
+	buffer := make([]byte, maxMessageSize)
+	for {
+		n, _, err := s.udp.ReadFrom(buffer)
+		if err != nil {
+			return closedErr(done, err)
+		}
+		if !send(messages, done, string(buffer[:n])) {
+			return nil
+		}
+	}
+}
+
+// accept reads each TCP connection in its own goroutine
+func (s *Server) accept(messages chan<- string, done <-chan struct{}) error {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return closedErr(done, err)
+		}
+		s.mutex.Lock()
+		if s.conns == nil {
+			// The server has been closed
+			s.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		go s.readTCP(conn, messages, done)
+	}
+}
+
+// readTCP reads the messages of a connection until it is closed
+// The messages are framed by their length (RFC 6587 octet counting) or separated by new lines
+// The connection is dropped at the first message larger than maxMessageSize
+func (s *Server) readTCP(conn net.Conn, messages chan<- string, done <-chan struct{}) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		message, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		if !send(messages, done, message) {
+			return
+		}
+	}
+}
+
+// readFrame reads the next message of a TCP stream, reader must be buffered with maxMessageSize
+// It fails on a message larger than maxMessageSize, the rest of the stream cannot be framed anymore
+func readFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		// The line is only read if it fits in the buffer
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return "", fmt.Errorf("message larger than %d bytes", maxMessageSize)
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		return string(line), err
+	}
+	// Octet counting: the length of the message, a space and the message
+	length, err := readLength(reader)
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n > maxMessageSize {
+		return "", fmt.Errorf("invalid message length %q", length)
+	}
+	message := make([]byte, n)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return "", err
+	}
+	return string(message), nil
+}
+
+// readLength reads the length of an octet counted message and the space after it
+// It fails if the length has more digits than maxMessageSize
+func readLength(reader *bufio.Reader) (string, error) {
+	var length strings.Builder
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == ' ' {
+			return length.String(), nil
+		}
+		if length.Len() == maxLengthDigits {
+			return "", fmt.Errorf("invalid message length %q", length.String()+string(c))
+		}
+		length.WriteByte(c)
+	}
+}
+
+// closedErr returns nil if err comes from the listener closed when Read returned
+func closedErr(done <-chan struct{}, err error) error {
+	select {
+	case <-done:
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,163 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Checks that the messages sent by local UDP and TCP clients are received without their envelope
+func TestServer_Read(t *testing.T) {
+	server, err := Listen("syslog://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- server.Read(ctx, func(line monitoring.Line) bool {
+			lines <- line.Text
+			return true
+		})
+	}()
+
+	udp, err := net.Dial("udp", server.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<190>Mar 27 12:00:00 edge-1 nginx: udp line")
+
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	// A message separated by a new line, then two messages framed by their length
+	fmt.Fprint(tcp, "<190>Mar 27 12:00:00 edge-1 nginx: tcp line\n")
+	for _, message := range []string{"<165>1 2020-03-27T12:00:00Z edge-1 nginx - - - framed line", "<190>Mar 27 12:00:00 edge-1 nginx: multi\nline"} {
+		fmt.Fprintf(tcp, "%d %s", len(message), message)
+	}
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(time.Second):
+			t.Fatalf("Read() received %v", got)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"framed line", "multi\nline", "tcp line", "udp line"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Read() received %q, want %q", got, want)
+	}
+
+	// The server stops with the context and closes the connections
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Read() err = %v", err)
+	}
+	tcp.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := tcp.Read(make([]byte, 1)); err == nil {
+		t.Errorf("the connection should be closed")
+	}
+}
+
+// Checks that the messages larger than maxMessageSize are rejected, whatever their framing
+func Test_readFrame(t *testing.T) {
+	large := strings.Repeat("a", maxMessageSize)
+	tests := []struct {
+		name    string
+		stream  string
+		want    string
+		wantErr bool
+	}{
+		{"test0", "tcp line\n", "tcp line\n", false},
+		{"test1", "tcp line", "tcp line", false},
+		{"test2", "5 hello", "hello", false},
+		{"test3", large + "\n", "", true},
+		{"test4", fmt.Sprintf("%d %s", len(large)+1, large+"a"), "", true},
+		{"test5", strings.Repeat("1", 100) + " a", "", true},
+		{"test6", "12a4 a", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFrame(bufio.NewReaderSize(strings.NewReader(tt.stream), maxMessageSize))
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("readFrame() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// Checks that a connection sending a message larger than maxMessageSize is dropped
+func TestServer_ReadTooLarge(t *testing.T) {
+	server, err := Listen("syslog+tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	go server.Read(ctx, func(line monitoring.Line) bool {
+		lines <- line.Text
+		return true
+	})
+
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	fmt.Fprint(tcp, strings.Repeat("a", 2*maxMessageSize)+"\n")
+	tcp.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = tcp.Read(make([]byte, 1))
+	if timeout, ok := err.(net.Error); err == nil || ok && timeout.Timeout() {
+		t.Errorf("the connection should be closed, err = %v", err)
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("Read() received a line of %d bytes", len(line))
+	default:
+	}
+}
+
+func TestListen(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		udp     bool
+		tcp     bool
+		wantErr bool
+	}{
+		{"test0", "syslog://127.0.0.1:0", true, true, false},
+		{"test1", "syslog+udp://127.0.0.1:0", true, false, false},
+		{"test2", "syslog+tcp://127.0.0.1:0", false, true, false},
+		{"test3", "http://127.0.0.1:0", false, false, true},
+		{"test4", "syslog://", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := Listen(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Listen() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer server.Close()
+			if (server.UDPAddr() != nil) != tt.udp || (server.TCPAddr() != nil) != tt.tcp {
+				t.Errorf("Listen() udp %v, tcp %v", server.UDPAddr(), server.TCPAddr())
+			}
+		})
+	}
+}
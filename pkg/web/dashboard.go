@@ -0,0 +1,224 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Baumanar/log-monitor/pkg/httpserver"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"github.com/Baumanar/log-monitor/pkg/notify"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// HistorySize is the number of intervals drawn in the histogram
+	HistorySize = 60
+	// MaxAlerts is the number of alerts kept for the browsers connecting later
+	MaxAlerts = 100
+	// clientBuffer is the number of events a browser can lag behind before being disconnected
+	clientBuffer = 64
+	// heartbeat is the delay between two comments keeping the event stream open through proxies
+	heartbeat = 15 * time.Second
+)
+
+// Alert is an AlertRecord with the message displayed for it
+type Alert struct {
+	monitoring.AlertRecord
+	Message string `json:"message"`
+}
+
+// Snapshot is the first event sent to a browser, it holds what the panels display so far
+type Snapshot struct {
+	// Number of seconds since the start of the dashboard
+	Uptime int64 `json:"uptime"`
+	// Requests of the last intervals, oldest first
+	History []int `json:"history"`
+	// Last statistics received, nil before the first interval
+	Stat *monitoring.StatRecord `json:"stat"`
+	// Last alerts, oldest first
+	Alerts []Alert `json:"alerts"`
+}
+
+// event is a Server-Sent Event
+type event struct {
+	name string
+	data []byte
+}
+
+// Dashboard is a Sink serving the panels of the terminal display to web browsers
+// The page at / is updated live with the Server-Sent Events of /events
+type Dashboard struct {
+	// mutex for thread safety, the sink and the HTTP handlers run in different goroutines
+	mutex   sync.Mutex
+	start   time.Time
+	history []int
+	stat    *monitoring.StatRecord
+	alerts  []Alert
+	// event channels of the connected browsers, a channel is closed to disconnect its browser
+	clients map[chan event]bool
+	closed  bool
+}
+
+// New returns a Dashboard without statistics
+func New() *Dashboard {
+	return &Dashboard{
+		start:   time.Now(),
+		clients: make(map[chan event]bool),
+	}
+}
+
+// WriteStat sends the statistics of an interval to the browsers
+func (d *Dashboard) WriteStat(stat monitoring.StatRecord) error {
+	data, err := json.Marshal(stat)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stat = &stat
+	d.history = append(d.history, stat.NumRequests)
+	if len(d.history) > HistorySize {
+		d.history = d.history[len(d.history)-HistorySize:]
+	}
+	d.broadcast(event{name: "stat", data: data})
+	return nil
+}
+
+// WriteAlert sends an alert, or a reload of the settings, to the browsers
+func (d *Dashboard) WriteAlert(alert monitoring.AlertRecord) error {
+	record := Alert{AlertRecord: alert, Message: notify.Message(alert)}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.alerts = append(d.alerts, record)
+	if len(d.alerts) > MaxAlerts {
+		d.alerts = d.alerts[len(d.alerts)-MaxAlerts:]
+	}
+	d.broadcast(event{name: "alert", data: data})
+	return nil
+}
+
+// Close disconnects the browsers, the page keeps showing the last values
+func (d *Dashboard) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.closed = true
+	for client := range d.clients {
+		d.disconnect(client)
+	}
+	return nil
+}
+
+// broadcast sends an event to every browser, a browser too slow to keep up is disconnected
+// the caller must hold the mutex
+func (d *Dashboard) broadcast(e event) {
+	for client := range d.clients {
+		select {
+		case client <- e:
+		default:
+			d.disconnect(client)
+		}
+	}
+}
+
+// disconnect closes the channel of a browser, the caller must hold the mutex
+func (d *Dashboard) disconnect(client chan event) {
+	delete(d.clients, client)
+	close(client)
+}
+
+// subscribe returns the snapshot of the panels and the channel of the next events
+// The channel is nil once the dashboard is closed
+func (d *Dashboard) subscribe() (Snapshot, chan event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	snapshot := Snapshot{
+		Uptime:  int64(time.Since(d.start).Seconds()),
+		History: append([]int{}, d.history...),
+		Stat:    d.stat,
+		Alerts:  append([]Alert{}, d.alerts...),
+	}
+	if d.closed {
+		return snapshot, nil
+	}
+	client := make(chan event, clientBuffer)
+	d.clients[client] = true
+	return snapshot, client
+}
+
+// unsubscribe stops sending events to a browser that left
+func (d *Dashboard) unsubscribe(client chan event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.clients[client] {
+		d.disconnect(client)
+	}
+}
+
+// ServeHTTP serves the page at / and the event stream at /events
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	case "/events":
+		d.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents streams the snapshot, then the statistics and the alerts as they are received
+func (d *Dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	snapshot, client := d.subscribe()
+	if client != nil {
+		defer d.unsubscribe(client)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeEvent(w, event{name: "snapshot", data: data})
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for client != nil {
+		select {
+		case e, ok := <-client:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes an event in the text/event-stream format, the JSON data holds no new line
+func writeEvent(w http.ResponseWriter, e event) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, e.data)
+}
+
+// Serve serves the dashboard on listener until ctx is cancelled
+func Serve(ctx context.Context, listener net.Listener, d *Dashboard) error {
+	return httpserver.Serve(ctx, listener, d)
+}
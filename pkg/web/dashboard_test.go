@@ -0,0 +1,134 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/Baumanar/log-monitor/pkg/monitoring"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next event of a text/event-stream, skipping the comments
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// Checks that the page is served
+func TestDashboard_page(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"test0", "/", http.StatusOK, "new EventSource(\"events\")"},
+		{"test1", "/other", http.StatusNotFound, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.want) {
+				t.Errorf("GET %s = %d %q", tt.path, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+// Checks that a browser receives the snapshot, then the records, until the dashboard is closed
+func TestDashboard_events(t *testing.T) {
+	dashboard := New()
+	dashboard.WriteStat(monitoring.StatRecord{NumRequests: 3})
+	dashboard.WriteAlert(monitoring.AlertRecord{Alert: true, NumTraffic: 1300})
+	server := httptest.NewServer(dashboard)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	reader := bufio.NewReader(resp.Body)
+	name, data := readEvent(t, reader)
+	var snapshot Snapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil || name != "snapshot" {
+		t.Fatalf("first event %s %s: %v", name, data, err)
+	}
+	if len(snapshot.History) != 1 || snapshot.Stat == nil || snapshot.Stat.NumRequests != 3 || len(snapshot.Alerts) != 1 ||
+		!strings.HasPrefix(snapshot.Alerts[0].Message, "High traffic generated an alert - hits = 1300") {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+
+	dashboard.WriteStat(monitoring.StatRecord{NumRequests: 5})
+	if name, data := readEvent(t, reader); name != "stat" || !strings.Contains(data, `"requests":5`) {
+		t.Errorf("event %s %s, want the statistics", name, data)
+	}
+	dashboard.WriteAlert(monitoring.AlertRecord{Reload: "threshold 20 (was 10)"})
+	if name, data := readEvent(t, reader); name != "alert" || !strings.Contains(data, `"message":"Settings reloaded - threshold 20 (was 10)`) {
+		t.Errorf("event %s %s, want the reload", name, data)
+	}
+
+	// Closing the dashboard ends the stream
+	dashboard.Close()
+	done := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(reader)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the stream is still open after Close")
+	}
+}
+
+// Checks that the history is bounded and that a browser too slow to keep up is disconnected
+func TestDashboard_broadcast(t *testing.T) {
+	dashboard := New()
+	_, client := dashboard.subscribe()
+	for i := 0; i < HistorySize+clientBuffer; i++ {
+		dashboard.WriteStat(monitoring.StatRecord{NumRequests: i})
+	}
+	snapshot, _ := dashboard.subscribe()
+	if len(snapshot.History) != HistorySize || snapshot.History[0] != clientBuffer {
+		t.Errorf("history of %d intervals starting with %d", len(snapshot.History), snapshot.History[0])
+	}
+	received := 0
+	for range client {
+		received++
+	}
+	if received != clientBuffer {
+		t.Errorf("the slow browser received %d events before being disconnected, want %d", received, clientBuffer)
+	}
+}
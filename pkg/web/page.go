@@ -0,0 +1,175 @@
+package web
+
+// page is the dashboard served at /, it has no external dependency so it works without internet access
+// It shows the panels of the terminal display and follows the events of /events
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>HTTP Log-monitor</title>
+<style>
+  body { margin: 0; padding: 12px; background: #111; color: #ddd; font: 14px monospace; }
+  h1 { font-size: 18px; margin: 0 0 12px; }
+  h2 { font-size: 14px; margin: 0 0 8px; color: #e5c07b; }
+  .grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(320px, 1fr)); gap: 12px; }
+  .panel { border: 1px solid #444; border-radius: 4px; padding: 8px 12px; }
+  .wide { grid-column: 1 / -1; }
+  .key { color: #e5c07b; }
+  .error { color: #e06c75; }
+  .fire { color: #e06c75; }
+  .warning { color: #e5c07b; }
+  .recover { color: #98c379; }
+  .reload { color: #61afef; }
+  #status { float: right; color: #888; }
+  #alerts { max-height: 240px; overflow-y: auto; white-space: pre-wrap; }
+  table { border-collapse: collapse; }
+  td, th { padding: 0 8px 0 0; text-align: right; }
+  td:first-child, th:first-child { text-align: left; }
+  svg { width: 100%; height: 120px; }
+  rect { fill: #56b6c2; }
+</style>
+</head>
+<body>
+<h1>HTTP Log-monitor <span id="status">connecting</span></h1>
+<div class="grid">
+  <div class="panel"><h2>Uptime</h2><div id="uptime">-</div></div>
+  <div class="panel"><h2>View</h2><select id="view"><option value="">all files</option></select></div>
+  <div class="panel"><h2>Traffic info</h2><div id="info">Waiting for the first update</div></div>
+  <div class="panel"><h2>Latency</h2><div id="latency"></div></div>
+  <div class="panel"><h2>Top clients</h2><div id="clients"></div></div>
+  <div class="panel wide"><h2>Alerts</h2><div id="alerts"></div></div>
+  <div class="panel wide"><h2>Requests per update</h2><svg id="histogram" preserveAspectRatio="none"></svg></div>
+</div>
+<script>
+"use strict";
+var uptime = 0, counts = [], last = null;
+
+function el(tag, text, cls) {
+  var e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  if (cls) e.className = cls;
+  return e;
+}
+
+function line(parent, key, value, cls) {
+  var div = el("div");
+  div.appendChild(el("span", key + ": ", "key"));
+  div.appendChild(el("span", String(value), cls));
+  parent.appendChild(div);
+}
+
+function pairs(parent, title, list) {
+  parent.appendChild(el("div", title, "key"));
+  (list || []).slice(0, 5).forEach(function (p) { parent.appendChild(el("div", "    " + p.key + ": " + p.value)); });
+}
+
+function pad(n) { return (n < 10 ? "0" : "") + n; }
+
+function showUptime() {
+  document.getElementById("uptime").textContent =
+    pad(Math.floor(uptime / 3600)) + "h" + pad(Math.floor(uptime / 60) % 60) + "min" + pad(uptime % 60) + "s";
+}
+
+function fmtLatency(ns) {
+  return ns < 1e9 ? (ns / 1e6).toFixed(1) + "ms" : (ns / 1e9).toFixed(2) + "s";
+}
+
+function showStat() {
+  if (!last) return;
+  var select = document.getElementById("view"), selected = select.value;
+  var names = Object.keys(last.sources || {}).sort();
+  while (select.options.length > 1) select.remove(1);
+  names.forEach(function (name) { select.add(new Option(name, name, false, name === selected)); });
+  var stat = selected && last.sources && last.sources[selected] ? last.sources[selected] : last;
+
+  var info = document.getElementById("info");
+  info.textContent = "";
+  line(info, "Interval", new Date(stat.time).toLocaleTimeString() + (last.partial ? " (partial)" : ""));
+  line(info, "Number of requests", stat.requests);
+  line(info, "Number of bytes transferred", stat.bytes);
+  line(info, "Parse errors", stat.parse_errors, stat.parse_errors > 0 ? "error" : "");
+  line(info, "Requests in the alerting window", last.window_traffic);
+  pairs(info, "Top sections:", stat.top_sections);
+  pairs(info, "Top methods:", stat.top_methods);
+  pairs(info, "Top status:", stat.top_status);
+
+  var latency = document.getElementById("latency");
+  latency.textContent = "";
+  if (!stat.latency) {
+    latency.textContent = "No request duration in the logs";
+  } else {
+    var table = el("table"), head = el("tr");
+    ["", "p50", "p90", "p99", "max"].forEach(function (h) { head.appendChild(el("th", h, "key")); });
+    table.appendChild(head);
+    var row = function (name, l) {
+      var tr = el("tr");
+      [name, fmtLatency(l.p50), fmtLatency(l.p90), fmtLatency(l.p99), fmtLatency(l.max)].forEach(function (v) { tr.appendChild(el("td", v)); });
+      table.appendChild(tr);
+    };
+    row("All", stat.latency);
+    (stat.top_sections || []).forEach(function (p) {
+      if (stat.section_latency && stat.section_latency[p.key]) row(p.key, stat.section_latency[p.key]);
+    });
+    latency.appendChild(table);
+  }
+
+  var clients = document.getElementById("clients");
+  clients.textContent = "";
+  pairs(clients, "Top hosts:", stat.top_hosts);
+  pairs(clients, "Top users:", stat.top_users);
+}
+
+function showHistogram() {
+  var svg = document.getElementById("histogram"), max = Math.max.apply(null, counts.concat([1]));
+  var width = 100 / Math.max(counts.length, 1);
+  svg.setAttribute("viewBox", "0 0 100 100");
+  svg.textContent = "";
+  counts.forEach(function (v, i) {
+    var rect = document.createElementNS("http://www.w3.org/2000/svg", "rect"), h = 100 * v / max;
+    rect.setAttribute("x", i * width);
+    rect.setAttribute("y", 100 - h);
+    rect.setAttribute("width", width * 0.9);
+    rect.setAttribute("height", h);
+    svg.appendChild(rect);
+  });
+}
+
+function addAlert(alert) {
+  var cls = "recover";
+  if (alert.reload) cls = "reload";
+  else if (alert.alert) cls = alert.rule && alert.severity !== "critical" ? "warning" : "fire";
+  var alerts = document.getElementById("alerts");
+  alerts.appendChild(el("div", alert.message, cls));
+  alerts.scrollTop = alerts.scrollHeight;
+}
+
+var source = new EventSource("events");
+source.addEventListener("snapshot", function (e) {
+  var snapshot = JSON.parse(e.data);
+  uptime = snapshot.uptime;
+  counts = snapshot.history || [];
+  last = snapshot.stat;
+  document.getElementById("alerts").textContent = "";
+  (snapshot.alerts || []).forEach(addAlert);
+  showUptime();
+  showStat();
+  showHistogram();
+});
+source.addEventListener("stat", function (e) {
+  last = JSON.parse(e.data);
+  counts.push(last.requests);
+  // HistorySize intervals are drawn
+  if (counts.length > 60) counts.shift();
+  showStat();
+  showHistogram();
+});
+source.addEventListener("alert", function (e) { addAlert(JSON.parse(e.data)); });
+source.onopen = function () { document.getElementById("status").textContent = "live"; };
+source.onerror = function () { document.getElementById("status").textContent = "disconnected, retrying"; };
+document.getElementById("view").onchange = showStat;
+setInterval(function () { uptime++; showUptime(); }, 1000);
+</script>
+</body>
+</html>
+`